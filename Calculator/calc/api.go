@@ -0,0 +1,245 @@
+package calc
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mode — числовая система, в которой вычисляются выражения: в REPL, в Evaluate и в RunBatch.
+type Mode int
+
+const (
+	ModeFloat   Mode = iota // float64
+	ModeRat                 // точные дроби big.Rat
+	ModeBig                 // произвольная точность big.Float
+	ModeComplex             // комплексные числа complex128
+	ModeUnits               // величины с единицами измерения quantity
+)
+
+var modeNames = []string{
+	ModeFloat:   "float",
+	ModeRat:     "rat",
+	ModeBig:     "big",
+	ModeComplex: "complex",
+	ModeUnits:   "units",
+}
+
+func (m Mode) String() string {
+	if m >= 0 && int(m) < len(modeNames) {
+		return modeNames[m]
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode находит режим по имени: float, rat, big, complex или units.
+func ParseMode(name string) (Mode, error) {
+	for m, n := range modeNames {
+		if n == name {
+			return Mode(m), nil
+		}
+	}
+	return 0, fmt.Errorf("неизвестный режим %q, доступны: %s", name, strings.Join(modeNames, ", "))
+}
+
+// Options — настройки Parse и Evaluate. Нулевое значение (и nil) — режим float, встроенные операторы,
+// только константы pi и e, без ограничений.
+type Options struct {
+	Mode      Mode               // числовая система: ModeFloat, ModeRat, ModeBig, ModeComplex или ModeUnits
+	Precision BigConfig          // точность и округление режима big; по умолчанию 50 десятичных знаков
+	Vars      map[string]float64 // значения переменных
+	Operators *OperatorSet       // свой набор операторов из NewOperatorSet; nil — встроенные
+	Limits    Limits             // ограничения на размер выражения
+}
+
+// Limits ограничивает выражения, пришедшие извне. Нулевое поле означает отсутствие ограничения.
+// Превышение — *CalcError с кодом ErrLimit.
+type Limits struct {
+	MaxLength int // наибольшая длина выражения в символах
+	MaxDepth  int // наибольшая вложенность скобок, включая скобки вызовов функций и списков
+}
+
+// check проверяет выражение и его токены на соответствие ограничениям.
+func (l Limits) check(expr string, tokens []Token) error {
+
+	if n := utf8.RuneCountInString(expr); l.MaxLength > 0 && n > l.MaxLength {
+		return &CalcError{Code: ErrLimit, Pos: l.MaxLength, End: n, Msg: fmt.Sprintf("выражение длиннее %d символов", l.MaxLength)}
+	}
+	if l.MaxDepth <= 0 {
+		return nil
+	}
+	depth := 0
+	for _, token := range tokens {
+		switch token.Kind {
+		case TokenLParen, TokenLBracket:
+			if depth++; depth > l.MaxDepth {
+				return errorAt(ErrLimit, token, "вложенность скобок больше %d", l.MaxDepth)
+			}
+		case TokenRParen, TokenRBracket:
+			depth--
+		}
+	}
+	return nil
+}
+
+// Result — значение выражения.
+type Result struct {
+	Text     string     // запись значения, как её печатает REPL режима: "0.3", "3/10", "3+4i", "5.3 m"
+	Value    float64    // приближение float64 или NaN, если его нет
+	HasValue bool       // false у комплексного числа с мнимой частью и у величины с размерностью
+	Rat      *big.Rat   // точное значение в режиме rat
+	Big      *big.Float // значение в режиме big
+	Complex  complex128 // значение в режиме complex
+}
+
+// String возвращает запись значения.
+func (r Result) String() string {
+	return r.Text
+}
+
+// Expression — разобранное выражение. Его можно вычислять много раз с разными значениями переменных,
+// в том числе одновременно из нескольких горутин.
+type Expression struct {
+	text    string
+	postfix []Token
+	opts    Options
+}
+
+// Parse разбирает выражение с настройками opts. Ошибки разбора — *CalcError с местом ошибки в выражении.
+// Присваивание "x = 2 + 3" разбирается как его правая часть: сохранить значение некуда.
+//
+// В режиме units единицы измерения распознаются при разборе: имя из opts.Vars остаётся переменной,
+// остальные имена единиц (m, km, h) — единицы.
+func Parse(expr string, opts *Options) (*Expression, error) {
+
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.Mode < 0 || int(opts.Mode) >= len(modeNames) {
+		return nil, fmt.Errorf("неизвестный режим %d", int(opts.Mode))
+	}
+	if err := opts.Limits.check(expr, nil); err != nil {
+		return nil, err
+	}
+
+	env := opts.env(nil)
+	tokens, err := tokenizeWith(expr, env.operators())
+	if err != nil {
+		return nil, err
+	}
+	if err := opts.Limits.check(expr, tokens); err != nil {
+		return nil, err
+	}
+	if opts.Mode == ModeUnits {
+		tokens = markUnits(tokens, env)
+	}
+	_, postfix, err := parseTokens(tokens, env)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &Expression{text: expr, postfix: postfix, opts: *opts}
+	e.opts.Vars = maps.Clone(opts.Vars)
+	return e, nil
+}
+
+// Eval вычисляет выражение. Значения vars дополняют Options.Vars, переданные в Parse, и заменяют их
+// при совпадении имён. Ошибки вычисления — *CalcError с местом ошибки в выражении.
+func (e *Expression) Eval(vars map[string]float64) (Result, error) {
+
+	env := e.opts.env(vars)
+	switch e.opts.Mode {
+	case ModeRat:
+		r, err := evaluatePostfixRat(e.postfix, env)
+		if err != nil {
+			return Result{}, err
+		}
+		value, _ := r.Float64()
+		return Result{Text: formatRat(r, -1), Value: value, HasValue: true, Rat: r}, nil
+
+	case ModeBig:
+		r, err := evaluatePostfixBig(e.postfix, env, e.opts.Precision)
+		if err != nil {
+			return Result{}, err
+		}
+		value, _ := r.Value.Float64()
+		return Result{Text: r.String(), Value: value, HasValue: true, Big: r.Value}, nil
+
+	case ModeComplex:
+		z, err := evaluatePostfixComplex(e.postfix, env)
+		if err != nil {
+			return Result{}, err
+		}
+		result := Result{Text: formatComplex(z, -1), Value: math.NaN(), Complex: z}
+		if imag(z) == 0 {
+			result.Value, result.HasValue = real(z), true
+		}
+		return result, nil
+
+	case ModeUnits:
+		q, err := evaluatePostfixUnits(e.postfix, env)
+		if err != nil {
+			return Result{}, err
+		}
+		result := Result{Text: formatQuantity(q, -1), Value: math.NaN()}
+		if q.dim.isZero() {
+			result.Value, result.HasValue = q.value, true
+		}
+		return result, nil
+	}
+
+	value, err := evaluatePostfix(e.postfix, env)
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{Text: formatNumber(value), Value: value, HasValue: true}, nil
+}
+
+// String возвращает исходную запись выражения.
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Postfix возвращает постфиксную запись выражения: токены в порядке вычисления, с местами в исходной строке.
+func (e *Expression) Postfix() []Token {
+	return append([]Token(nil), e.postfix...)
+}
+
+// Evaluate разбирает и вычисляет выражение с настройками opts:
+//
+//	r, err := calc.Evaluate("x^2 + 1", &calc.Options{Vars: map[string]float64{"x": 3}})  // r.Value == 10
+//	r, err := calc.Evaluate("0.1 + 0.2", &calc.Options{Mode: calc.ModeRat})               // r.Text == "3/10"
+//
+// Ошибки разбора и вычисления — *CalcError с кодом и местом ошибки в выражении.
+func Evaluate(expr string, opts *Options) (Result, error) {
+	e, err := Parse(expr, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	return e.Eval(nil)
+}
+
+// MustEvaluate — Evaluate, который паникует при ошибке. Подходит для выражений, известных заранее.
+func MustEvaluate(expr string, opts *Options) Result {
+	result, err := Evaluate(expr, opts)
+	if err != nil {
+		panic(fmt.Sprintf("calc: MustEvaluate(%q): %v", expr, err))
+	}
+	return result
+}
+
+// env создаёт окружение вычисления: константы, переменные из настроек и vars поверх них.
+func (o *Options) env(vars map[string]float64) *Env {
+	env := NewEnv()
+	env.SetOperators(o.Operators)
+	for name, value := range o.Vars {
+		env.Set(name, value)
+	}
+	for name, value := range vars {
+		env.Set(name, value)
+	}
+	return env
+}
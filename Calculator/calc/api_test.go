@@ -0,0 +1,187 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expr     string
+		opts     *Options
+		text     string
+		value    float64
+		hasValue bool
+	}{
+		{"2 * (3 + 4)", nil, "14", 14, true},
+		{"x^2 + y", &Options{Vars: map[string]float64{"x": 3, "y": 0.5}}, "9.5", 9.5, true},
+		{"x = 2 + 3", nil, "5", 5, true},
+		{"0.1 + 0.2", &Options{Mode: ModeRat}, "3/10", 0.3, true},
+		{"2^64 + 1/8", &Options{Mode: ModeBig, Precision: BigConfig{Digits: 25}}, "18446744073709551616.125", 1 << 64, true},
+		{"sqrt(-4)", &Options{Mode: ModeComplex}, "2i", math.NaN(), false},
+		{"(1+i)*(1-i)", &Options{Mode: ModeComplex}, "2", 2, true},
+		{"100 km/h in m/s", &Options{Mode: ModeUnits}, "27.7777777777778 m/s", math.NaN(), false},
+		{"10 m / (4 m)", &Options{Mode: ModeUnits}, "2.5", 2.5, true},
+		{"m * 2", &Options{Mode: ModeUnits, Vars: map[string]float64{"m": 3}}, "6", 6, true},
+	}
+
+	for _, tt := range tests {
+		result, err := Evaluate(tt.expr, tt.opts)
+		if err != nil {
+			t.Errorf("Evaluate(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		sameValue := result.Value == tt.value || math.IsNaN(result.Value) && math.IsNaN(tt.value)
+		if result.Text != tt.text || !sameValue || result.HasValue != tt.hasValue {
+			t.Errorf("Evaluate(%q) = %+v, expected %q, %v, %v", tt.expr, result, tt.text, tt.value, tt.hasValue)
+		}
+	}
+
+	// Точное значение доступно в своём поле
+	if r := MustEvaluate("1/3 + 1/6", &Options{Mode: ModeRat}); r.Rat == nil || r.Rat.RatString() != "1/2" {
+		t.Errorf("MustEvaluate rat = %+v, expected exact 1/2", r)
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		opts *Options
+		code ErrorCode
+		pos  int
+	}{
+		{"1 / (x - 2)", &Options{Vars: map[string]float64{"x": 2}}, ErrDivisionByZero, 2},
+		{"y + 1", nil, ErrUndefinedVariable, 0},
+		{"1 xor 0", nil, ErrMissingOperator, 2},
+		{"5 m + 3 s", &Options{Mode: ModeUnits}, ErrDimension, 4},
+		{"1 + 2 + 3", &Options{Limits: Limits{MaxLength: 5}}, ErrLimit, 5},
+		{"((1)) + (((2)))", &Options{Limits: Limits{MaxDepth: 2}}, ErrLimit, 10},
+		{"max(1, (2))", &Options{Limits: Limits{MaxDepth: 1}}, ErrLimit, 7},
+	}
+
+	for _, tt := range tests {
+		_, err := Evaluate(tt.expr, tt.opts)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code || calcErr.Pos != tt.pos {
+			t.Errorf("Evaluate(%q) error = %v, expected %v at %d", tt.expr, err, tt.code, tt.pos)
+		}
+	}
+
+	if _, err := Evaluate("1", &Options{Mode: Mode(42)}); err == nil {
+		t.Errorf("Evaluate with unknown mode: expected error")
+	}
+	if _, err := Evaluate("((1))", &Options{Limits: Limits{MaxLength: 5, MaxDepth: 2}}); err != nil {
+		t.Errorf("Evaluate within limits unexpected error: %v", err)
+	}
+}
+
+func TestParseAndEval(t *testing.T) {
+	e, err := Parse("price * (1 + tax%) - discount", &Options{Vars: map[string]float64{"tax": 20, "discount": 0}})
+	if err != nil {
+		t.Fatalf("Parse unexpected error: %v", err)
+	}
+	if e.String() != "price * (1 + tax%) - discount" {
+		t.Errorf("String() = %q", e.String())
+	}
+	if got := textsOf(e.Postfix()); !reflect.DeepEqual(got, []string{"price", "1", "tax", "100", "+", "*", "100", "/", "*", "discount", "-"}) {
+		t.Errorf("Postfix() = %v", got)
+	}
+	// Процент от левой части считается без лишнего округления
+	if r, err := Evaluate("200 + 15%", nil); err != nil || r.Value != 230 {
+		t.Errorf("Evaluate(\"200 + 15%%\") = %v, %v, expected Value 230", r.Value, err)
+	}
+
+	tests := []struct {
+		vars     map[string]float64
+		expected float64
+	}{
+		{map[string]float64{"price": 100}, 120},
+		{map[string]float64{"price": 100, "tax": 0}, 100},
+		{map[string]float64{"price": 50, "discount": 10}, 50},
+	}
+	for _, tt := range tests {
+		result, err := e.Eval(tt.vars)
+		if err != nil || math.Abs(result.Value-tt.expected) > 1e-9 {
+			t.Errorf("Eval(%v) = %v, %v, expected %v", tt.vars, result.Value, err, tt.expected)
+		}
+	}
+
+	// Переменные Eval не попадают в настройки выражения
+	if _, err := e.Eval(nil); err == nil {
+		t.Errorf("Eval(nil) without price: expected error")
+	}
+
+	// Одно выражение можно вычислять из нескольких горутин
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			price := float64(i)
+			result, err := e.Eval(map[string]float64{"price": price})
+			if err != nil || math.Abs(result.Value-price*1.2) > 1e-9 {
+				t.Errorf("concurrent Eval(price=%v) = %v, %v", price, result.Value, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParseWithOperators(t *testing.T) {
+	opts := &Options{Operators: customOperators(t)}
+	if r, err := Evaluate("1 xor 1", opts); err != nil || r.Value != 0 {
+		t.Errorf("Evaluate(\"1 xor 1\") = %v, %v, expected 0", r.Value, err)
+	}
+}
+
+func TestMustEvaluatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustEvaluate(\"1 / 0\"): expected panic")
+		}
+	}()
+	MustEvaluate("1 / 0", nil)
+}
+
+func ExampleEvaluate() {
+	r, err := Evaluate("200 + 15%", nil)
+	fmt.Println(r, err)
+
+	r, err = Evaluate("0.1 + 0.2", &Options{Mode: ModeRat})
+	fmt.Println(r, err)
+
+	_, err = Evaluate("5 m + 3 s", &Options{Mode: ModeUnits})
+	fmt.Println(err)
+	// Output:
+	// 230 <nil>
+	// 3/10 <nil>
+	// несовместимые размерности: m и s (позиция 5)
+}
+
+func ExampleDerivative() {
+	tree, err := ParseTree("x^3 + 2*x*y")
+	if err != nil {
+		panic(err)
+	}
+	d, err := Derivative(tree, "x")
+	if err != nil {
+		panic(err)
+	}
+	simplified, _ := Simplify(d)
+	fmt.Println(Format(simplified))
+	// Output:
+	// 3 * x^2 + 2 * y
+}
+
+func TestModeString(t *testing.T) {
+	if got := ModeUnits.String(); got != "units" {
+		t.Errorf("ModeUnits.String() = %q, expected units", got)
+	}
+	if got := fmt.Sprint(Mode(9)); got != "Mode(9)" {
+		t.Errorf("Mode(9) prints as %q, expected Mode(9)", got)
+	}
+}
@@ -0,0 +1,330 @@
+package calc
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Node — узел синтаксического дерева выражения.
+// Каждый узел помнит место своего токена в исходной строке (Span), чтобы ошибки вычисления указывали туда же,
+// куда указывает постфиксный конвейер. У узлов, построенных программно, Span нулевой.
+type Node interface {
+	span() Span
+}
+
+// NumberNode — числовая константа. Imag отмечает мнимую константу вида 4i.
+type NumberNode struct {
+	Span
+	Value float64
+	Imag  bool
+}
+
+// VarNode — обращение к переменной.
+type VarNode struct {
+	Span
+	Name string
+}
+
+// UnaryNode — префиксный оператор: смена знака "-" или логическое отрицание "!".
+type UnaryNode struct {
+	Span
+	Op string
+	X  Node
+}
+
+// BinaryNode — бинарный оператор: + - * / ^, сравнение, && или ||.
+type BinaryNode struct {
+	Span
+	Op          string
+	Left, Right Node
+}
+
+// CondNode — условное выражение Cond ? Then : Else.
+type CondNode struct {
+	Span
+	Cond, Then, Else Node
+}
+
+// CallNode — вызов встроенной функции.
+type CallNode struct {
+	Span
+	Name string
+	Args []Node
+}
+
+// ParseTree разбирает строку выражения в синтаксическое дерево со встроенными функциями и операторами.
+// Дерево можно напечатать (Format), продифференцировать (Derivative) и упростить (Simplify).
+func ParseTree(expr string) (Node, error) {
+	postfix, err := toPostfix(expr)
+	if err != nil {
+		return nil, err
+	}
+	return buildTree(postfix)
+}
+
+// buildTree собирает дерево из постфиксной записи тем же стековым обходом, что и evaluatePostfix,
+// только вместо чисел на стеке лежат поддеревья. Дерево знает только встроенные операторы.
+func buildTree(postfix []Token) (Node, error) {
+
+	var stack []Node
+
+	for i := 0; i < len(postfix); i++ {
+		token := postfix[i]
+		switch token.Kind {
+		case TokenNumber, TokenImag:
+			if err := inRange(token); err != nil {
+				return nil, err
+			}
+			stack = append(stack, &NumberNode{Span: token.span(), Value: token.Value, Imag: token.Kind == TokenImag})
+
+		case TokenIdent:
+			stack = append(stack, &VarNode{Span: token.span(), Name: token.Text})
+
+		case TokenCall:
+			if len(stack) < token.Argc {
+				return nil, errorAt(ErrMissingOperand, token, "недостаточно операндов (чисел) для функции %s", token.Text)
+			}
+			args := make([]Node, token.Argc)
+			copy(args, stack[len(stack)-token.Argc:])
+			stack = append(stack[:len(stack)-token.Argc], &CallNode{Span: token.span(), Name: token.Text, Args: args})
+
+		case TokenJumpIfFalse:
+			// Переходы в постфиксной записи условного выражения и логических операторов
+			// делят её на ветки: собираем каждую отдельно
+			if len(stack) < 1 {
+				return nil, errorAt(ErrMissingOperand, token, "недостаточно операндов (чисел) для оператора %s", token.Text)
+			}
+			cond := stack[len(stack)-1]
+			elseStart := i + 1 + token.Argc
+			if token.Argc < 1 || elseStart > len(postfix) || postfix[elseStart-1].Kind != TokenJump {
+				return nil, &CalcError{Code: ErrEvaluation, Pos: -1, Msg: "ошибка вычисления выражения"}
+			}
+			end := min(elseStart+postfix[elseStart-1].Argc, len(postfix))
+			then, err := buildTree(postfix[i+1 : elseStart-1])
+			if err != nil {
+				return nil, err
+			}
+			otherwise, err := buildTree(postfix[elseStart:end])
+			if err != nil {
+				return nil, err
+			}
+
+			var node Node = &CondNode{Span: token.span(), Cond: cond, Then: then, Else: otherwise}
+			switch token.Text {
+			case "&&": // a ? !!b : 0
+				node = &BinaryNode{Span: token.span(), Op: "&&", Left: cond, Right: unwrapBoolean(then)}
+			case "||": // a ? 1 : !!b
+				node = &BinaryNode{Span: token.span(), Op: "||", Left: cond, Right: unwrapBoolean(otherwise)}
+			}
+			stack[len(stack)-1] = node
+			i = end - 1
+
+		case TokenOperator:
+			if token.Text == unaryMinus || token.Text == logicalNot || token.Text == toBoolean {
+				if len(stack) < 1 {
+					return nil, errorAt(ErrMissingOperand, token, "недостаточно операндов (чисел) для оператора %s", prefixSymbol(token.Text))
+				}
+				stack[len(stack)-1] = &UnaryNode{Span: token.span(), Op: prefixSymbol(token.Text), X: stack[len(stack)-1]}
+				continue
+			}
+			op := token.Text
+			if canonical, ok := operatorAliases[op]; ok {
+				op = canonical
+			}
+			if _, ok := builtinOperators.binaryOp(op); !ok {
+				return nil, errorAt(ErrUnknownToken, token, "неизвестный токен: %s", token.Text)
+			}
+			if len(stack) < 2 {
+				return nil, errorAt(ErrMissingOperand, token, "недостаточно операндов (чисел) для оператора %s", token.Text)
+			}
+			node := &BinaryNode{Span: token.span(), Op: op, Left: stack[len(stack)-2], Right: stack[len(stack)-1]}
+			stack = append(stack[:len(stack)-2], node)
+
+		default:
+			return nil, errorAt(ErrUnknownToken, token, "неизвестный токен: %s", token.Text)
+		}
+	}
+
+	if len(stack) != 1 {
+		return nil, &CalcError{Code: ErrEvaluation, Pos: -1, Msg: "ошибка вычисления выражения"}
+	}
+	return stack[0], nil
+}
+
+// unwrapBoolean снимает приведение !! с правой части && и ||: в дереве его выполняет сам оператор.
+func unwrapBoolean(n Node) Node {
+	if u, ok := n.(*UnaryNode); ok && u.Op == toBoolean {
+		return u.X
+	}
+	return n
+}
+
+// evalTree вычисляет дерево рекурсивным обходом. Ошибки те же, что у evaluatePostfix;
+// условное выражение, && и || вычисляют только нужные ветки.
+func evalTree(n Node, env *Env) (float64, error) {
+
+	switch n := n.(type) {
+	case *NumberNode:
+		if n.Imag {
+			return 0, imaginaryError(n)
+		}
+		return n.Value, nil
+
+	case *VarNode:
+		return lookupVariable(n, env, n.Name)
+
+	case *UnaryNode:
+		x, err := evalTree(n.X, env)
+		if err != nil {
+			return 0, err
+		}
+		switch n.Op {
+		case logicalNot:
+			return boolToFloat(x == 0), nil
+		case toBoolean:
+			return boolToFloat(x != 0), nil
+		}
+		return -x, nil
+
+	case *CondNode:
+		cond, err := evalTree(n.Cond, env)
+		if err != nil {
+			return 0, err
+		}
+		if cond != 0 {
+			return evalTree(n.Then, env)
+		}
+		return evalTree(n.Else, env)
+
+	case *BinaryNode:
+		left, err := evalTree(n.Left, env)
+		if err != nil {
+			return 0, err
+		}
+		if n.Op == "&&" && left == 0 || n.Op == "||" && left != 0 {
+			return boolToFloat(left != 0), nil
+		}
+		right, err := evalTree(n.Right, env)
+		if err != nil {
+			return 0, err
+		}
+		if n.Op == "&&" || n.Op == "||" {
+			return boolToFloat(right != 0), nil
+		}
+		op, ok := builtinOperators.binaryOp(n.Op)
+		if !ok {
+			return 0, errorAt(ErrUnknownToken, n, "неизвестный токен: %s", n.Op)
+		}
+		return applyOperator(n, op, left, right)
+
+	case *CallNode:
+		args := make([]float64, len(n.Args))
+		for i, arg := range n.Args {
+			value, err := evalTree(arg, env)
+			if err != nil {
+				return 0, err
+			}
+			args[i] = value
+		}
+		return callFunction(n, n.Name, args)
+	}
+
+	return 0, &CalcError{Code: ErrEvaluation, Pos: -1, Msg: "ошибка вычисления выражения"}
+}
+
+// Format печатает дерево в инфиксной записи с минимумом скобок.
+// Скобки ставятся только там, где без них разбор дал бы другое дерево, поэтому ParseTree(Format(n)) восстанавливает n.
+func Format(n Node) string {
+	var b strings.Builder
+	writeNode(&b, n)
+	return b.String()
+}
+
+// nodePriority — приоритет узла как операнда: у чисел, переменных и вызовов он выше любого оператора,
+// у условного выражения — ниже любого.
+func nodePriority(n Node) int {
+	switch n := n.(type) {
+	case *CondNode:
+		return 0
+	case *UnaryNode:
+		return builtinOperators.precedence(unaryMinus)
+	case *BinaryNode:
+		return builtinOperators.precedence(n.Op)
+	case *NumberNode:
+		if n.Value < 0 {
+			return builtinOperators.precedence(unaryMinus) // отрицательная константа печатается как "-x"
+		}
+	}
+	return builtinOperators.precedence("^") + 1
+}
+
+// isPrefix сообщает, начинается ли запись узла с унарного минуса.
+// Такой узел справа от бинарного оператора не требует скобок: минус в позиции операнда всегда префиксный.
+// Исключение — остаток: в 7 % -3 знак % читается как процент, поэтому пишется 7 % (-3).
+func isPrefix(n Node) bool {
+	return nodePriority(n) == builtinOperators.precedence(unaryMinus)
+}
+
+func writeNode(b *strings.Builder, n Node) {
+
+	switch n := n.(type) {
+	case *NumberNode:
+		b.WriteString(strconv.FormatFloat(n.Value, 'f', -1, 64))
+		if n.Imag {
+			b.WriteByte('i')
+		}
+
+	case *VarNode:
+		b.WriteString(n.Name)
+
+	case *UnaryNode:
+		b.WriteString(n.Op)
+		writeOperand(b, n.X, nodePriority(n.X) < builtinOperators.precedence(unaryMinus))
+
+	case *BinaryNode:
+		p := builtinOperators.precedence(n.Op)
+		op, ok := builtinOperators.binaryOp(n.Op)
+		rightAssoc := ok && op.RightAssoc
+		leftP, rightP := nodePriority(n.Left), nodePriority(n.Right)
+		writeOperand(b, n.Left, leftP < p || leftP == p && rightAssoc)
+		if n.Op == "^" {
+			b.WriteString(n.Op)
+		} else {
+			b.WriteString(" " + n.Op + " ")
+		}
+		if isPrefix(n.Right) {
+			writeOperand(b, n.Right, n.Op == "%")
+		} else {
+			writeOperand(b, n.Right, rightP < p || rightP == p && !rightAssoc)
+		}
+
+	case *CondNode:
+		// Ветка "да" ограничена знаками ? и :, ветка "нет" правоассоциативна — скобки нужны только условию
+		writeOperand(b, n.Cond, nodePriority(n.Cond) == 0)
+		b.WriteString(" ? ")
+		writeNode(b, n.Then)
+		b.WriteString(" : ")
+		writeNode(b, n.Else)
+
+	case *CallNode:
+		b.WriteString(n.Name)
+		b.WriteByte('(')
+		for i, arg := range n.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeNode(b, arg)
+		}
+		b.WriteByte(')')
+	}
+}
+
+func writeOperand(b *strings.Builder, n Node, parens bool) {
+	if parens {
+		b.WriteByte('(')
+	}
+	writeNode(b, n)
+	if parens {
+		b.WriteByte(')')
+	}
+}
@@ -0,0 +1,138 @@
+package calc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestBuildTree(t *testing.T) {
+	tree, err := ParseTree("-x + max(2, y)^3")
+	if err != nil {
+		t.Fatalf("ParseTree unexpected error: %v", err)
+	}
+
+	sum, ok := tree.(*BinaryNode)
+	if !ok || sum.Op != "+" {
+		t.Fatalf("root = %#v, expected + node", tree)
+	}
+	neg, ok := sum.Left.(*UnaryNode)
+	if !ok || neg.Op != "-" {
+		t.Fatalf("left = %#v, expected unary -", sum.Left)
+	}
+	if x, ok := neg.X.(*VarNode); !ok || x.Name != "x" || x.Pos != 1 {
+		t.Errorf("operand of - = %#v, expected variable x at 1", neg.X)
+	}
+	pow, ok := sum.Right.(*BinaryNode)
+	if !ok || pow.Op != "^" {
+		t.Fatalf("right = %#v, expected ^ node", sum.Right)
+	}
+	call, ok := pow.Left.(*CallNode)
+	if !ok || call.Name != "max" || len(call.Args) != 2 {
+		t.Fatalf("base = %#v, expected max with 2 arguments", pow.Left)
+	}
+	if n, ok := call.Args[0].(*NumberNode); !ok || n.Value != 2 {
+		t.Errorf("first argument = %#v, expected 2", call.Args[0])
+	}
+}
+
+func TestFormatTree(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"((1 + 2))", "1 + 2"},
+		{"(1 + 2) * 3", "(1 + 2) * 3"},
+		{"1 + (2 * 3)", "1 + 2 * 3"},
+		{"(1 - 2) - 3", "1 - 2 - 3"},
+		{"1 - (2 - 3)", "1 - (2 - 3)"},
+		{"1 - (2 + 3)", "1 - (2 + 3)"},
+		{"8 / (4 / 2)", "8 / (4 / 2)"},
+		{"(2 ^ 3) ^ 2", "(2^3)^2"},
+		{"2 ** (3 ** 2)", "2^3^2"},
+		{"-(2^2)", "-2^2"},
+		{"(-2)^2", "(-2)^2"},
+		{"-(1 + x)", "-(1 + x)"},
+		{"-(x * y)", "-(x * y)"},
+		{"(-x) * y", "-x * y"},
+		{"2 ^ (-x)", "2^-x"},
+		{"3 - (-2)", "3 - -2"},
+		{"--3", "--3"},
+		{"7 mod -3", "7 % (-3)"},
+		{"7 mod !x", "7 % (!x)"},
+		{"max(1, (2 + 3)) * sqrt((4))", "max(1, 2 + 3) * sqrt(4)"},
+		{"0.5 * 1000000", "0.5 * 1000000"},
+		{"(1 < 2) == (3 > x)", "1 < 2 == (3 > x)"},
+		{"(a || b) && !(c == 1)", "(a || b) && !(c == 1)"},
+		{"a || (b && c)", "a || b && c"},
+		{"!!x", "!!x"},
+		{"-!x", "-!x"},
+		{"(a ? b : c) ? d : e", "(a ? b : c) ? d : e"},
+		{"a ? (b ? c : d) : (e ? f : g)", "a ? b ? c : d : e ? f : g"},
+		{"(a ? 1 : 2) + 3", "(a ? 1 : 2) + 3"},
+		{"x > 0 && y > 0 ? x + y : -1", "x > 0 && y > 0 ? x + y : -1"},
+	}
+
+	for _, tt := range tests {
+		tree, err := ParseTree(tt.expr)
+		if err != nil {
+			t.Errorf("ParseTree(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		got := Format(tree)
+		if got != tt.expected {
+			t.Errorf("Format(ParseTree(%q)) = %q, expected %q", tt.expr, got, tt.expected)
+		}
+
+		// Напечатанное дерево должно разбираться обратно в ту же постфиксную запись
+		original, _ := toPostfix(tt.expr)
+		reparsed, err := toPostfix(got)
+		if err != nil {
+			t.Errorf("toPostfix(%q) unexpected error: %v", got, err)
+			continue
+		}
+		if !reflect.DeepEqual(textsOf(reparsed), textsOf(original)) {
+			t.Errorf("%q round-trips to %v, expected %v", tt.expr, textsOf(reparsed), textsOf(original))
+		}
+	}
+}
+
+func TestFormatSynthesizedTree(t *testing.T) {
+	tree := &BinaryNode{Op: "^", Left: &NumberNode{Value: -2}, Right: &NumberNode{Value: -1}}
+	if got := Format(tree); got != "(-2)^-1" {
+		t.Errorf("Format = %q, expected %q", got, "(-2)^-1")
+	}
+}
+
+func TestTreeErrorsMatchPostfix(t *testing.T) {
+	tests := []string{
+		"10 / (5 - 5)",
+		"2 * unknown",
+		"log(1, 5)",
+	}
+
+	for _, expr := range tests {
+		var errs []*CalcError
+		for _, p := range pipelines {
+			_, err := p.eval(expr, nil)
+			var calcErr *CalcError
+			if !errors.As(err, &calcErr) {
+				t.Fatalf("%s(%q) error = %v, expected *CalcError", p.name, expr, err)
+			}
+			errs = append(errs, calcErr)
+		}
+		a, b := errs[0], errs[1]
+		if a.Code != b.Code || a.Pos != b.Pos || a.End != b.End || a.Msg != b.Msg {
+			t.Errorf("%q: postfix error %+v, tree error %+v", expr, errs[0], errs[1])
+		}
+	}
+}
+
+func TestSynthesizedTreeErrorHasNoPosition(t *testing.T) {
+	tree := &BinaryNode{Op: "/", Left: &NumberNode{Value: 1}, Right: &NumberNode{Value: 0}}
+	_, err := evalTree(tree, nil)
+	var calcErr *CalcError
+	if !errors.As(err, &calcErr) || calcErr.Code != ErrDivisionByZero || calcErr.Pos != -1 {
+		t.Errorf("evalTree error = %#v, expected division by zero without position", err)
+	}
+}
@@ -0,0 +1,156 @@
+package calc
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxBatchLine ограничивает длину одной строки пакетного режима.
+const maxBatchLine = 1 << 20
+
+// BatchFormat — формат вывода RunBatch.
+type BatchFormat int
+
+const (
+	FormatCSV   BatchFormat = iota // CSV с заголовком line,input,result,code,error
+	FormatJSONL                    // JSON Lines: по объекту на строку
+)
+
+var batchFormatNames = []string{
+	FormatCSV:   "csv",
+	FormatJSONL: "jsonl",
+}
+
+func (f BatchFormat) String() string {
+	if f >= 0 && int(f) < len(batchFormatNames) {
+		return batchFormatNames[f]
+	}
+	return fmt.Sprintf("BatchFormat(%d)", int(f))
+}
+
+// ParseBatchFormat находит формат вывода по имени: csv или jsonl.
+func ParseBatchFormat(name string) (BatchFormat, error) {
+	for f, n := range batchFormatNames {
+		if n == name {
+			return BatchFormat(f), nil
+		}
+	}
+	return 0, fmt.Errorf("неизвестный формат %q, доступны: %s", name, strings.Join(batchFormatNames, ", "))
+}
+
+// BatchConfig — настройки RunBatch.
+type BatchConfig struct {
+	Format   BatchFormat
+	Parallel int     // сколько строк вычислять одновременно; 0 и 1 — по одной
+	Options  Options // режим, переменные и ограничения, общие для всех строк
+}
+
+// batchRecord — результат одной строки. В JSON Lines у успешной строки есть result (и value, как у /eval:
+// только конечное приближение float64, у NaN и бесконечности его нет),
+// у ошибочной — error в том же виде, что в ответах сервера.
+type batchRecord struct {
+	Line   int        `json:"line"`
+	Input  string     `json:"input"`
+	Result string     `json:"result,omitempty"`
+	Value  *float64   `json:"value,omitempty"`
+	Error  *errorJSON `json:"error,omitempty"`
+}
+
+// RunBatch читает из in по выражению на строке, вычисляет каждое независимо от остальных
+// и пишет результаты в out в формате cfg.Format в порядке строк:
+//
+//	line,input,result,code,error
+//	1,2 + 2,4,,
+//	2,1 / 0,,division-by-zero,деление на ноль
+//
+// Номера строк считаются с 1, пустые строки пропускаются, но учитываются в нумерации.
+// Присваивания между строками не сохраняются: каждая строка вычисляется в своём окружении.
+// Возвращает число строк с ошибками; ошибка RunBatch — только ошибка чтения или записи.
+func RunBatch(in io.Reader, out io.Writer, cfg BatchConfig) (failed int, err error) {
+
+	if cfg.Format != FormatCSV && cfg.Format != FormatJSONL {
+		return 0, fmt.Errorf("неизвестный формат %d", int(cfg.Format))
+	}
+
+	var records []batchRecord
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchLine)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSuffix(scanner.Text(), "\r")
+		if strings.TrimSpace(text) != "" {
+			records = append(records, batchRecord{Line: line, Input: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	// Строки раздаются обработчикам по номеру, результат каждой записывается на своё место
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range max(cfg.Parallel, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				records[i].evaluate(&cfg.Options)
+			}
+		}()
+	}
+	for i := range records {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, record := range records {
+		if record.Error != nil {
+			failed++
+		}
+	}
+	if cfg.Format == FormatJSONL {
+		return failed, writeBatchJSONL(out, records)
+	}
+	return failed, writeBatchCSV(out, records)
+}
+
+func (r *batchRecord) evaluate(opts *Options) {
+	result, err := Evaluate(r.Input, opts)
+	if err != nil {
+		body := newErrorJSON(err)
+		r.Error = &body
+		return
+	}
+	r.Result, r.Value = result.Text, finiteValue(result)
+}
+
+func writeBatchCSV(out io.Writer, records []batchRecord) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"line", "input", "result", "code", "error"})
+	for _, r := range records {
+		row := []string{strconv.Itoa(r.Line), r.Input, r.Result, "", ""}
+		if r.Error != nil {
+			row[3], row[4] = r.Error.Code, r.Error.Message
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func writeBatchJSONL(out io.Writer, records []batchRecord) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false) // выражения с < и && остаются читаемыми
+	for _, r := range records {
+		if err := encoder.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
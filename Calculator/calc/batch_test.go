@@ -0,0 +1,139 @@
+package calc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+const batchInput = "2 + 2\n\n1 / 0\r\nx = 200 + 15%\nx\n  \n\"a\" + 1\n"
+
+func TestRunBatchCSV(t *testing.T) {
+	var out strings.Builder
+	failed, err := RunBatch(strings.NewReader(batchInput), &out, BatchConfig{})
+	if err != nil {
+		t.Fatalf("RunBatch unexpected error: %v", err)
+	}
+
+	expected := strings.Join([]string{
+		"line,input,result,code,error",
+		"1,2 + 2,4,,",
+		"3,1 / 0,,division-by-zero,деление на ноль",
+		"4,x = 200 + 15%,230,,",
+		"5,x,,undefined-variable,неизвестная переменная: x",
+		`7,"""a"" + 1",,unknown-token,"неизвестный токен: """`,
+	}, "\n") + "\n"
+	if out.String() != expected || failed != 3 {
+		t.Errorf("RunBatch = %d failed,\n%s\nexpected 3 failed,\n%s", failed, out.String(), expected)
+	}
+}
+
+func TestRunBatchJSONL(t *testing.T) {
+	var out strings.Builder
+	cfg := BatchConfig{Format: FormatJSONL, Options: Options{Mode: ModeComplex, Vars: map[string]float64{"r": 2}}}
+	failed, err := RunBatch(strings.NewReader("sqrt(-r^2)\nr < 3 && r > 1\n1 +\n"), &out, cfg)
+	if err != nil || failed != 1 {
+		t.Fatalf("RunBatch = %d, %v, expected 1 failed", failed, err)
+	}
+
+	expected := []string{
+		`{"line":1,"input":"sqrt(-r^2)","result":"2i"}`,
+		`{"line":2,"input":"r < 3 && r > 1","result":"1","value":1}`,
+		`{"line":3,"input":"1 +","error":{"code":"missing-operand","message":"выражение оборвано: пропущен операнд","pos":3,"end":4}}`,
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("RunBatch output:\n%s\nexpected %d lines", out.String(), len(expected))
+	}
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("line %d = %s, expected %s", i+1, line, expected[i])
+		}
+		if !json.Valid([]byte(line)) {
+			t.Errorf("line %d is not valid JSON: %s", i+1, line)
+		}
+	}
+}
+
+// NaN и бесконечность в JSON не записать: у таких строк нет value, но остальные строки выводятся
+func TestRunBatchJSONLNonFinite(t *testing.T) {
+	var out strings.Builder
+	failed, err := RunBatch(strings.NewReader("sqrt(-1)\n1+1\n1e308*10\n"), &out, BatchConfig{Format: FormatJSONL})
+	if err != nil || failed != 0 {
+		t.Fatalf("RunBatch = %d, %v, expected no failures", failed, err)
+	}
+
+	expected := strings.Join([]string{
+		`{"line":1,"input":"sqrt(-1)","result":"NaN"}`,
+		`{"line":2,"input":"1+1","result":"2","value":2}`,
+		`{"line":3,"input":"1e308*10","result":"+Inf"}`,
+	}, "\n") + "\n"
+	if out.String() != expected {
+		t.Errorf("RunBatch output:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+// Огромный результат режима big не должен останавливать пакет: строка падает с ошибкой, остальные считаются
+func TestRunBatchBigExponent(t *testing.T) {
+	var out strings.Builder
+	start := time.Now()
+	failed, err := RunBatch(strings.NewReader("exp(1e9)\n2^10\n10^100000000\n"), &out, BatchConfig{Format: FormatJSONL, Options: Options{Mode: ModeBig}})
+	if err != nil || failed != 2 {
+		t.Fatalf("RunBatch = %d, %v, expected 2 failed", failed, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("RunBatch took %v", elapsed)
+	}
+
+	expected := strings.Join([]string{
+		`{"line":1,"input":"exp(1e9)","error":{"code":"domain","message":"переполнение: результат больше 2^65536","pos":0,"end":3}}`,
+		`{"line":2,"input":"2^10","result":"1024","value":1024}`,
+		`{"line":3,"input":"10^100000000","error":{"code":"domain","message":"переполнение: результат больше 2^65536","pos":2,"end":3}}`,
+	}, "\n") + "\n"
+	if out.String() != expected {
+		t.Errorf("RunBatch output:\n%s\nexpected:\n%s", out.String(), expected)
+	}
+}
+
+func TestRunBatchParallel(t *testing.T) {
+	var input strings.Builder
+	for i := range 500 {
+		if i%7 == 0 {
+			fmt.Fprintf(&input, "%d / 0\n", i)
+		} else {
+			fmt.Fprintf(&input, "%d * 2 + %d %% 3\n", i, i)
+		}
+	}
+
+	var sequential, parallel strings.Builder
+	failedSeq, err := RunBatch(strings.NewReader(input.String()), &sequential, BatchConfig{Format: FormatJSONL})
+	if err != nil {
+		t.Fatalf("RunBatch unexpected error: %v", err)
+	}
+	failedPar, err := RunBatch(strings.NewReader(input.String()), &parallel, BatchConfig{Format: FormatJSONL, Parallel: 8})
+	if err != nil {
+		t.Fatalf("RunBatch parallel unexpected error: %v", err)
+	}
+	if sequential.String() != parallel.String() || failedSeq != failedPar || failedSeq != 72 {
+		t.Errorf("parallel RunBatch differs from sequential: %d and %d failed", failedSeq, failedPar)
+	}
+}
+
+func TestParseBatchFormat(t *testing.T) {
+	for _, name := range []string{"csv", "jsonl"} {
+		if f, err := ParseBatchFormat(name); err != nil || f.String() != name {
+			t.Errorf("ParseBatchFormat(%q) = %v, %v", name, f, err)
+		}
+	}
+	if got := BatchFormat(5).String(); got != "BatchFormat(5)" {
+		t.Errorf("BatchFormat(5).String() = %q, expected BatchFormat(5)", got)
+	}
+	if _, err := ParseBatchFormat("xml"); err == nil {
+		t.Errorf("ParseBatchFormat(\"xml\"): expected error")
+	}
+	if _, err := RunBatch(strings.NewReader("1"), &strings.Builder{}, BatchConfig{Format: BatchFormat(5)}); err == nil {
+		t.Errorf("RunBatch with unknown format: expected error")
+	}
+}
@@ -0,0 +1,573 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// defaultBigDigits — точность режима big по умолчанию, в десятичных знаках.
+const defaultBigDigits = 50
+
+// guardBits — запас точности для промежуточных вычислений в функциях (exp, ln, sin...),
+// чтобы после округления до заданной точности все знаки результата были верными.
+const guardBits = 64
+
+// maxTrigExp ограничивает двоичный порядок аргумента sin, cos и tan: приведение к периоду
+// требует столько же дополнительных бит точности, и sin(2^1000000) считался бы минутами.
+const maxTrigExp = 4096
+
+// maxBigExp ограничивает двоичный порядок чисел режима big: |x| < 2^maxBigExp, а ненулевые |x| >= 2^-maxBigExp.
+// big.Float хранит порядок до 2^31, но перевод такого числа в десятичную запись длится минутами.
+const maxBigExp = 1 << 16
+
+// BigConfig — настройки вычисления в числах произвольной точности big.Float.
+// Точность задаётся либо в битах мантиссы (Prec), либо в десятичных знаках (Digits);
+// если не задано ни то, ни другое, берётся defaultBigDigits знаков.
+type BigConfig struct {
+	Prec     uint
+	Digits   int
+	Rounding big.RoundingMode
+}
+
+// BigResult — результат вычисления вместе с фактически использованной точностью.
+type BigResult struct {
+	Value    *big.Float
+	Prec     uint             // точность мантиссы в битах
+	Digits   int              // сколько десятичных знаков этой точности гарантированно верны
+	Rounding big.RoundingMode // режим округления арифметических операций
+}
+
+// String печатает результат с Digits значащими знаками.
+func (r BigResult) String() string {
+	return r.Value.Text('g', r.Digits)
+}
+
+// resolve вычисляет точность в битах и число верных десятичных знаков для конфигурации.
+func (c BigConfig) resolve() (prec uint, digits int) {
+	switch {
+	case c.Prec > 0:
+		return c.Prec, int(float64(c.Prec) * math.Log10(2))
+	case c.Digits > 0:
+		return precForDigits(c.Digits), c.Digits
+	default:
+		return precForDigits(defaultBigDigits), defaultBigDigits
+	}
+}
+
+// precForDigits — сколько бит мантиссы нужно, чтобы digits десятичных знаков были верны после округления.
+func precForDigits(digits int) uint {
+	return uint(math.Ceil(float64(digits)*math.Log2(10))) + 4
+}
+
+var roundingNames = map[string]big.RoundingMode{
+	"nearest-even": big.ToNearestEven,
+	"nearest-away": big.ToNearestAway,
+	"zero":         big.ToZero,
+	"away":         big.AwayFromZero,
+	"down":         big.ToNegativeInf,
+	"up":           big.ToPositiveInf,
+}
+
+// parseRounding находит режим округления по имени: nearest-even, nearest-away, zero, away, down, up.
+func parseRounding(name string) (big.RoundingMode, error) {
+	mode, ok := roundingNames[name]
+	if !ok {
+		return 0, fmt.Errorf("неизвестный режим округления %q, доступны: nearest-even, nearest-away, zero, away, down, up", name)
+	}
+	return mode, nil
+}
+
+// roundingName — имя режима округления в том виде, в каком его принимает parseRounding.
+func roundingName(mode big.RoundingMode) string {
+	for name, m := range roundingNames {
+		if m == mode {
+			return name
+		}
+	}
+	return strings.ToLower(mode.String())
+}
+
+// evaluatePostfixBig вычисляет постфиксную запись в big.Float с точностью из cfg.
+// Каждая арифметическая операция округляется до этой точности в режиме cfg.Rounding, как в IEEE 754;
+// функции считаются с запасом точности и округляются один раз.
+func evaluatePostfixBig(postfix []Token, env *Env, cfg BigConfig) (BigResult, error) {
+	prec, digits := cfg.resolve()
+	value, err := runPostfix[*big.Float](postfix, env, bigArithmetic{prec: prec, mode: cfg.Rounding})
+	if err != nil {
+		return BigResult{}, err
+	}
+	return BigResult{Value: value, Prec: prec, Digits: digits, Rounding: cfg.Rounding}, nil
+}
+
+// evaluateBig вычисляет строку в режиме big; присвоенное значение сохраняется в env с полной точностью.
+func evaluateBig(line string, env *Env, cfg BigConfig) (BigResult, error) {
+
+	name, postfix, err := parseStatement(line, env)
+	if err != nil {
+		return BigResult{}, err
+	}
+	result, err := evaluatePostfixBig(postfix, env, cfg)
+	if err != nil {
+		return BigResult{}, err
+	}
+
+	if name != "" {
+		env.setBig(name, result.Value)
+	}
+	return result, nil
+}
+
+// bigArithmetic — вычисление в big.Float с точностью prec бит.
+type bigArithmetic struct {
+	prec uint
+	mode big.RoundingMode
+}
+
+// float создаёт новое число с точностью и режимом округления вычисления.
+func (a bigArithmetic) float() *big.Float {
+	return new(big.Float).SetPrec(a.prec).SetMode(a.mode)
+}
+
+func (a bigArithmetic) number(tok Token) (*big.Float, error) {
+	if err := realOnly(tok); err != nil {
+		return nil, err
+	}
+	// Запись уже проверил лексер: Parse отказывает, только если показатель степени не помещается в int,
+	// а ноль при ненулевых цифрах означает, что число меньше наименьшего big.Float
+	f, _, err := a.float().Parse(tok.Text, 0)
+	if err != nil || f.IsInf() || outOfRange(f) || f.Sign() == 0 && nonzeroDigits(tok.Text) {
+		return nil, errorAt(ErrDomain, tok, "число %s вне диапазона: двоичный порядок больше %d по модулю", tok.Text, maxBigExp)
+	}
+	return f, nil
+}
+
+func (a bigArithmetic) variable(tok Token, env *Env) (*big.Float, error) {
+	if f, ok := env.getBig(tok.Text); ok {
+		return a.float().Set(f), nil
+	}
+	if r, ok := env.getRat(tok.Text); ok {
+		return checkOverflow(tok, a.float().SetRat(r), nil)
+	}
+	value, err := lookupVariable(tok, env, tok.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	// Встроенные константы считаются заново с нужной точностью, если их не переопределили
+	switch {
+	case tok.Text == "pi" && value == math.Pi:
+		return a.float().Set(bigPi(a.prec + guardBits)), nil
+	case tok.Text == "e" && value == math.E:
+		return a.float().Set(bigExp(big.NewFloat(1), a.prec+guardBits)), nil
+	case math.IsInf(value, 0) || math.IsNaN(value):
+		return nil, errorAt(ErrDomain, tok, "значение %s не является конечным числом", tok.Text)
+	}
+	return a.float().SetFloat64(value), nil
+}
+
+func (a bigArithmetic) prefix(tok Token, _ *Operator, x *big.Float) (*big.Float, error) {
+	if tok.Text != unaryMinus {
+		return nil, unsupportedOperator(tok)
+	}
+	return a.float().Neg(x), nil
+}
+
+func (a bigArithmetic) binary(tok Token, _ *Operator, left, right *big.Float) (*big.Float, error) {
+	result, err := a.apply(tok, left, right)
+	return checkOverflow(tok, result, err)
+}
+
+// checkOverflow заменяет ошибкой бесконечный результат и результат с порядком за пределами maxBigExp.
+// big.Float при переполнении даёт ±Inf, а Inf - Inf, 0 * Inf или Inf / Inf дальше по выражению
+// паникуют с big.ErrNaN.
+func checkOverflow(tok Token, x *big.Float, err error) (*big.Float, error) {
+	switch {
+	case err != nil:
+		return x, err
+	case x.IsInf() || outOfRange(x) && x.MantExp(nil) > 0:
+		return nil, errorAt(ErrDomain, tok, "переполнение: результат больше 2^%d", maxBigExp)
+	case outOfRange(x):
+		return nil, errorAt(ErrDomain, tok, "исчезновение порядка: результат меньше 2^-%d", maxBigExp)
+	}
+	return x, nil
+}
+
+// nonzeroDigits сообщает, есть ли в записи числа ненулевые цифры до показателя степени.
+func nonzeroDigits(text string) bool {
+	mantissa, _, _ := strings.Cut(strings.ToLower(text), "e")
+	return strings.ContainsAny(mantissa, "123456789")
+}
+
+// outOfRange сообщает, что двоичный порядок конечного x выходит за пределы ±maxBigExp.
+func outOfRange(x *big.Float) bool {
+	e := x.MantExp(nil)
+	return e > maxBigExp || x.Sign() != 0 && e < -maxBigExp
+}
+
+func (a bigArithmetic) apply(tok Token, left, right *big.Float) (*big.Float, error) {
+	switch tok.Text {
+	case "+":
+		return a.float().Add(left, right), nil
+	case "-":
+		return a.float().Sub(left, right), nil
+	case "*":
+		return a.float().Mul(left, right), nil
+	case "/":
+		if right.Sign() == 0 {
+			return nil, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+		}
+		return a.float().Quo(left, right), nil
+	case "%", "//":
+		if right.Sign() == 0 {
+			return nil, errorAt(ErrDivisionByZero, tok, "%s", divisionByZero(tok.Text))
+		}
+		return a.floorDiv(tok, left, right)
+	case "^", "**":
+		return a.pow(tok, left, right)
+	}
+	if isComparison(tok.Text) {
+		return a.boolean(compareResult(tok.Text, left.Cmp(right))), nil
+	}
+	return nil, unsupportedOperator(tok)
+}
+
+func (a bigArithmetic) truth(x *big.Float) bool {
+	return x.Sign() != 0
+}
+
+func (a bigArithmetic) boolean(b bool) *big.Float {
+	return a.float().SetFloat64(boolToFloat(b))
+}
+
+// floorDiv вычисляет частное x // y, округлённое вниз, или остаток x % y со знаком делителя.
+func (a bigArithmetic) floorDiv(tok Token, x, y *big.Float) (*big.Float, error) {
+
+	quo := new(big.Float).SetPrec(a.prec+guardBits).Quo(x, y)
+	if quo.IsInf() {
+		return nil, errorAt(ErrDomain, tok, "частное не является конечным числом")
+	}
+	floor, acc := quo.Int(nil)
+	if acc == big.Above {
+		floor.Sub(floor, big.NewInt(1)) // Int округляет к нулю, а отрицательное частное нужно вниз
+	}
+	q := new(big.Float).SetPrec(a.prec + guardBits).SetInt(floor)
+
+	// Частное могло округлиться вверх до целого: тогда остаток получится со знаком, противоположным делителю
+	r := new(big.Float).SetPrec(a.prec+guardBits).Sub(x, new(big.Float).SetPrec(a.prec+guardBits).Mul(q, y))
+	if r.Sign() != 0 && r.Sign() != y.Sign() {
+		q.Sub(q, big.NewFloat(1))
+		r.Add(r, y)
+	}
+	if tok.Text == "//" {
+		return a.float().Set(q), nil
+	}
+	return a.float().Set(r), nil
+}
+
+// pow возводит в степень: целую — умножениями, дробную — через exp(y*ln(x)).
+func (a bigArithmetic) pow(tok Token, base, exp *big.Float) (*big.Float, error) {
+
+	if exp.IsInt() && exp.MantExp(nil) <= 62 {
+		n, _ := exp.Int64()
+		if n < 0 && base.Sign() == 0 {
+			return nil, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+		}
+		wp := a.prec + guardBits
+		result := new(big.Float).SetPrec(wp).SetInt64(1)
+		square := new(big.Float).SetPrec(wp).Set(base)
+		for k := n; k != 0; k /= 2 {
+			if k%2 != 0 {
+				result.Mul(result, square)
+			}
+			square.Mul(square, square)
+		}
+		if n < 0 {
+			result.Quo(new(big.Float).SetPrec(wp).SetInt64(1), result)
+		}
+		return a.float().Set(result), nil
+	}
+
+	switch base.Sign() {
+	case 0:
+		if exp.Sign() < 0 {
+			return nil, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+		}
+		return a.float(), nil
+	case -1:
+		return nil, errorAt(ErrDomain, tok, "отрицательное число нельзя возвести в дробную степень")
+	}
+	wp := a.prec + guardBits
+	ln := bigLn(base, wp)
+	return a.float().Set(bigExp(ln.Mul(ln, exp), wp)), nil
+}
+
+func (a bigArithmetic) call(tok Token, args []*big.Float) (*big.Float, error) {
+
+	if err := checkCall(tok, tok.Text, len(args)); err != nil {
+		return nil, err
+	}
+
+	wp := a.prec + guardBits
+	x := args[0]
+	var result *big.Float
+
+	switch tok.Text {
+	case "abs":
+		result = new(big.Float).Abs(x)
+	case "re", "conj":
+		result = x
+	case "im":
+		result = new(big.Float)
+	case "min", "max":
+		result = x
+		for _, arg := range args[1:] {
+			if c := arg.Cmp(result); tok.Text == "min" && c < 0 || tok.Text == "max" && c > 0 {
+				result = arg
+			}
+		}
+	case "sum", "avg":
+		result = bigSum(args, wp)
+		if tok.Text == "avg" {
+			result.Quo(result, new(big.Float).SetInt64(int64(len(args))))
+		}
+	case "prod":
+		result = new(big.Float).SetPrec(wp).SetInt64(1)
+		for _, arg := range args {
+			result.Mul(result, arg)
+		}
+	case "median":
+		sorted := slices.SortedFunc(slices.Values(args), (*big.Float).Cmp)
+		n := len(sorted)
+		result = sorted[n/2]
+		if n%2 == 0 {
+			result = new(big.Float).SetPrec(wp).Add(sorted[n/2-1], sorted[n/2])
+			result.Quo(result, big.NewFloat(2))
+		}
+	case "var", "stddev", "hypot":
+		// Сумма квадратов отклонений от среднего, у hypot — самих значений
+		n := new(big.Float).SetInt64(int64(len(args)))
+		center := new(big.Float)
+		if tok.Text != "hypot" {
+			center = bigSum(args, wp)
+			center.Quo(center, n)
+		}
+		result = new(big.Float).SetPrec(wp)
+		for _, arg := range args {
+			d := new(big.Float).SetPrec(wp).Sub(arg, center)
+			result.Add(result, d.Mul(d, d))
+		}
+		if tok.Text != "hypot" {
+			result.Quo(result, n.Sub(n, big.NewFloat(1)))
+		}
+		if tok.Text != "var" {
+			result.Sqrt(result)
+		}
+	case "sqrt":
+		if x.Sign() < 0 {
+			return nil, errorAt(ErrDomain, tok, "квадратный корень из отрицательного числа")
+		}
+		result = new(big.Float).SetPrec(wp).Sqrt(x)
+	case "exp":
+		result = bigExp(x, wp)
+	case "ln", "log":
+		for _, arg := range args {
+			if arg.Sign() <= 0 {
+				return nil, errorAt(ErrDomain, tok, "логарифм определён только для положительных чисел")
+			}
+		}
+		switch {
+		case tok.Text == "ln":
+			result = bigLn(x, wp)
+		case len(args) == 1:
+			result = new(big.Float).Quo(bigLn(x, wp), bigLn(big.NewFloat(10), wp))
+		default:
+			lnBase := bigLn(x, wp)
+			if lnBase.Sign() == 0 {
+				return nil, errorAt(ErrDomain, tok, "недопустимое основание логарифма: 1")
+			}
+			result = new(big.Float).Quo(bigLn(args[1], wp), lnBase)
+		}
+	case "sin", "cos", "tan":
+		if x.MantExp(nil) > maxTrigExp {
+			return nil, errorAt(ErrDomain, tok, "аргумент %s слишком велик: больше 2^%d", tok.Text, maxTrigExp)
+		}
+		sin, cos := bigSinCos(x, wp)
+		switch tok.Text {
+		case "sin":
+			result = sin
+		case "cos":
+			result = cos
+		default:
+			result = new(big.Float).Quo(sin, cos)
+		}
+	default:
+		return nil, errorAt(ErrDomain, tok, "функция %s недоступна в режиме произвольной точности", tok.Text)
+	}
+
+	return checkOverflow(tok, a.float().Set(result), nil)
+}
+
+// bigSum складывает args с точностью prec бит.
+func bigSum(args []*big.Float, prec uint) *big.Float {
+	result := new(big.Float).SetPrec(prec)
+	for _, arg := range args {
+		result.Add(result, arg)
+	}
+	return result
+}
+
+// negligible сообщает, что term уже не влияет на сумму sum с точностью prec бит.
+func negligible(term, sum *big.Float, prec uint) bool {
+	return term.Sign() == 0 || sum.Sign() != 0 && term.MantExp(nil) < sum.MantExp(nil)-int(prec)
+}
+
+// bigExp вычисляет e^x рядом Тейлора. Аргумент сначала делится на 2^k, чтобы ряд быстро сходился,
+// а результат потом k раз возводится в квадрат.
+func bigExp(x *big.Float, prec uint) *big.Float {
+
+	// При |x| >= 2^17 порядок e^x по модулю больше maxBigExp: сразу возвращается число за этой границей,
+	// которое отвергнет checkOverflow, иначе пришлось бы до 2^31 раз возводить в квадрат
+	if x.MantExp(nil) > 17 {
+		return new(big.Float).SetPrec(prec).SetMantExp(big.NewFloat(0.5), x.Sign()*(maxBigExp+1))
+	}
+
+	k := 0
+	if e := x.MantExp(nil); e > -1 {
+		k = e + 1
+	}
+	wp := prec + uint(k) + 16
+
+	r := new(big.Float).SetPrec(wp).SetMantExp(x, -k)
+	sum := new(big.Float).SetPrec(wp).SetInt64(1)
+	term := new(big.Float).SetPrec(wp).SetInt64(1)
+	for n := int64(1); ; n++ {
+		term.Mul(term, r)
+		term.Quo(term, new(big.Float).SetInt64(n))
+		sum.Add(sum, term)
+		if negligible(term, sum, wp) {
+			break
+		}
+	}
+	for ; k > 0; k-- {
+		sum.Mul(sum, sum)
+	}
+	return sum.SetPrec(prec)
+}
+
+// bigAtanh вычисляет atanh(z) рядом z + z^3/3 + z^5/5 + ... при |z| <= 1/3.
+func bigAtanh(z *big.Float, prec uint) *big.Float {
+	sum := new(big.Float).SetPrec(prec).Set(z)
+	power := new(big.Float).SetPrec(prec).Set(z)
+	z2 := new(big.Float).SetPrec(prec).Mul(z, z)
+	for n := int64(3); ; n += 2 {
+		power.Mul(power, z2)
+		term := new(big.Float).SetPrec(prec).Quo(power, new(big.Float).SetInt64(n))
+		sum.Add(sum, term)
+		if negligible(term, sum, prec) {
+			return sum
+		}
+	}
+}
+
+// bigLn вычисляет натуральный логарифм положительного x через ln(x) = 2*atanh((x-1)/(x+1)).
+// Числа вне [1/2, 2) сначала приводятся к мантиссе m*2^e, и ln(x) = ln(m) + e*ln(2).
+func bigLn(x *big.Float, prec uint) *big.Float {
+
+	wp := prec + 16
+	one := new(big.Float).SetInt64(1)
+
+	lnNear1 := func(m *big.Float) *big.Float {
+		num := new(big.Float).SetPrec(wp).Sub(m, one)
+		den := new(big.Float).SetPrec(wp).Add(m, one)
+		z := num.Quo(num, den)
+		result := bigAtanh(z, wp)
+		return result.Mul(result, big.NewFloat(2))
+	}
+
+	if x.Cmp(big.NewFloat(0.5)) >= 0 && x.Cmp(big.NewFloat(2)) < 0 {
+		return lnNear1(x).SetPrec(prec)
+	}
+
+	m := new(big.Float).SetPrec(wp)
+	e := x.MantExp(m)
+	ln2 := bigAtanh(new(big.Float).SetPrec(wp).Quo(one, big.NewFloat(3)), wp)
+	ln2.Mul(ln2, big.NewFloat(2))
+
+	result := lnNear1(m)
+	result.Add(result, ln2.Mul(ln2, new(big.Float).SetInt64(int64(e))))
+	return result.SetPrec(prec)
+}
+
+// bigAtanInv вычисляет atan(1/n) рядом 1/n - 1/(3n^3) + 1/(5n^5) - ...
+func bigAtanInv(n int64, prec uint) *big.Float {
+	power := new(big.Float).SetPrec(prec).Quo(big.NewFloat(1), new(big.Float).SetInt64(n))
+	sum := new(big.Float).SetPrec(prec).Set(power)
+	n2 := new(big.Float).SetInt64(n * n)
+	for k := int64(1); ; k++ {
+		power.Quo(power, n2)
+		term := new(big.Float).SetPrec(prec).Quo(power, new(big.Float).SetInt64(2*k+1))
+		if k%2 == 1 {
+			term.Neg(term)
+		}
+		sum.Add(sum, term)
+		if negligible(term, sum, prec) {
+			return sum
+		}
+	}
+}
+
+// bigPi вычисляет π по формуле Мэчина: π = 16*atan(1/5) - 4*atan(1/239).
+func bigPi(prec uint) *big.Float {
+	wp := prec + 16
+	pi := bigAtanInv(5, wp)
+	pi.Mul(pi, big.NewFloat(16))
+	pi.Sub(pi, bigAtanInv(239, wp).Mul(bigAtanInv(239, wp), big.NewFloat(4)))
+	return pi.SetPrec(prec)
+}
+
+// bigSinCos вычисляет синус и косинус рядами Тейлора после приведения аргумента к [-π, π].
+func bigSinCos(x *big.Float, prec uint) (sin, cos *big.Float) {
+
+	extra := uint(0)
+	if e := x.MantExp(nil); e > 0 {
+		extra = uint(e) // столько бит теряется при вычитании кратного 2π
+	}
+	wp := prec + extra + 16
+
+	twoPi := bigPi(wp)
+	twoPi.Mul(twoPi, big.NewFloat(2))
+	turns := new(big.Float).SetPrec(wp).Quo(x, twoPi)
+	n, acc := turns.Add(turns, big.NewFloat(0.5)).Int(nil) // округление до ближайшего целого
+	if acc == big.Above {
+		n.Sub(n, big.NewInt(1)) // Int отбрасывает дробную часть к нулю, а нужно вниз
+	}
+	r := new(big.Float).SetPrec(wp).SetInt(n)
+	r.Sub(x, r.Mul(r, twoPi))
+
+	sin = new(big.Float).SetPrec(wp).Set(r)
+	cos = new(big.Float).SetPrec(wp).SetInt64(1)
+	term := new(big.Float).SetPrec(wp).Set(r) // r^k / k!
+	for k := int64(2); ; k++ {
+		term.Mul(term, r)
+		term.Quo(term, new(big.Float).SetInt64(k))
+
+		// Чётные степени идут в косинус, нечётные — в синус; знаки чередуются через две степени
+		target := cos
+		if k%2 == 1 {
+			target = sin
+		}
+		if k%4 >= 2 {
+			target.Sub(target, term)
+		} else {
+			target.Add(target, term)
+		}
+
+		if term.Sign() == 0 || term.MantExp(nil) < -int(wp) {
+			break
+		}
+	}
+	return sin.SetPrec(prec), cos.SetPrec(prec)
+}
@@ -0,0 +1,219 @@
+package calc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestEvaluateBig(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"0.1 + 0.2", "0.3"},
+		{"1/3", "0.33333333333333333333333333333333333333333333333333"},
+		{"pi", "3.1415926535897932384626433832795028841971693993751"},
+		{"e", "2.7182818284590452353602874713526624977572470937"},
+		{"sqrt(2)", "1.4142135623730950488016887242096980785696718753769"},
+		{"2^0.5", "1.4142135623730950488016887242096980785696718753769"},
+		{"ln(2)", "0.69314718055994530941723212145817656807550013436026"},
+		{"exp(1)", "2.7182818284590452353602874713526624977572470937"},
+		{"log(1000)", "3"},
+		{"log(2, 1024)", "10"},
+		{"sin(1)", "0.84147098480789650665250232163029899962256306079837"},
+		{"cos(pi)", "-1"},
+		{"tan(0)", "0"},
+		{"2^200", "1.6069380442589902755419620923411626025222029937828e+60"},
+		{"2^-3", "0.125"},
+		{"abs(-2) * max(1, 3) - min(4, 5)", "2"},
+		{"sum([0.1, 0.2])", "0.3"},
+		{"median(1, 3, 2, 10) * prod(2, 2)", "10"},
+		{"var(1, 2, 3, 4) * 3", "5"},
+		{"stddev(2, 4, 4, 4, 5, 5, 7, 9)^2 * 7", "32"},
+		{"hypot(3, 4, 12)", "13"},
+		{"exp(-1e4) < 1e-4000", "1"},
+		{"1e400 * 1e-399", "10"},
+		{"cos(2^100) ^ 2 + sin(2^100) ^ 2", "1"},
+		{"1/4 + 1/4 == 0.5", "1"},
+		{"sqrt(2) > 1.5 || 0", "0"},
+		{"pi > 3 ? 1/8 : 0", "0.125"},
+		{"-7.5 % 2", "0.5"},
+		{"7 mod -2", "-1"},
+		{"2^100 // 3", "422550200076076467165567735125"},
+		{"2^100 % 3", "1"},
+		{"200 - 15%", "170"},
+	}
+
+	for _, tt := range tests {
+		result, err := evaluateBig(tt.expr, NewEnv(), BigConfig{})
+		if err != nil {
+			t.Errorf("evaluateBig(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := result.String(); got != tt.expected {
+			t.Errorf("evaluateBig(%q) = %s, expected %s", tt.expr, got, tt.expected)
+		}
+	}
+}
+
+func TestBigPrecision(t *testing.T) {
+	tests := []struct {
+		cfg    BigConfig
+		prec   uint
+		digits int
+	}{
+		{BigConfig{}, 171, 50},
+		{BigConfig{Digits: 20}, 71, 20},
+		{BigConfig{Prec: 53}, 53, 15},
+		{BigConfig{Prec: 256, Digits: 10}, 256, 77},
+	}
+
+	for _, tt := range tests {
+		result, err := evaluateBig("1/7", nil, tt.cfg)
+		if err != nil {
+			t.Fatalf("evaluateBig unexpected error: %v", err)
+		}
+		if result.Prec != tt.prec || result.Digits != tt.digits || result.Value.Prec() != tt.prec {
+			t.Errorf("config %+v: prec %d (value %d), digits %d; expected prec %d, digits %d",
+				tt.cfg, result.Prec, result.Value.Prec(), result.Digits, tt.prec, tt.digits)
+		}
+	}
+
+	result, err := evaluateBig("sin(100)", nil, BigConfig{Digits: 30})
+	if err != nil {
+		t.Fatalf("evaluateBig unexpected error: %v", err)
+	}
+	if got := result.String(); got != "-0.50636564110975879365655761046" {
+		t.Errorf("sin(100) = %s", got)
+	}
+}
+
+func TestBigRounding(t *testing.T) {
+	down, err := evaluateBig("1/3", nil, BigConfig{Prec: 8, Rounding: big.ToNegativeInf})
+	if err != nil {
+		t.Fatalf("evaluateBig unexpected error: %v", err)
+	}
+	up, err := evaluateBig("1/3", nil, BigConfig{Prec: 8, Rounding: big.ToPositiveInf})
+	if err != nil {
+		t.Fatalf("evaluateBig unexpected error: %v", err)
+	}
+	if down.Value.Cmp(up.Value) >= 0 {
+		t.Errorf("rounding down gave %s, rounding up gave %s", down.Value.Text('g', 10), up.Value.Text('g', 10))
+	}
+	if down.Rounding != big.ToNegativeInf || up.Rounding != big.ToPositiveInf {
+		t.Errorf("result does not record the rounding mode: %v, %v", down.Rounding, up.Rounding)
+	}
+
+	for _, name := range []string{"nearest-even", "nearest-away", "zero", "away", "down", "up"} {
+		mode, err := parseRounding(name)
+		if err != nil || roundingName(mode) != name {
+			t.Errorf("parseRounding(%q) = %v, %v", name, mode, err)
+		}
+	}
+	if _, err := parseRounding("sideways"); err == nil {
+		t.Errorf("parseRounding(sideways) expected error")
+	}
+}
+
+func TestBigVariables(t *testing.T) {
+	env := NewEnv()
+	if _, err := evaluateBig("x = 1/3", env, BigConfig{}); err != nil {
+		t.Fatalf("evaluateBig unexpected error: %v", err)
+	}
+	result, err := evaluateBig("x * 3", env, BigConfig{})
+	if err != nil {
+		t.Fatalf("evaluateBig unexpected error: %v", err)
+	}
+	if got := result.String(); got != "1" {
+		t.Errorf("x * 3 = %s, expected 1", got)
+	}
+	if value, _ := env.Get("x"); value != 1.0/3 {
+		t.Errorf("float value of x = %v, expected %v", value, 1.0/3)
+	}
+}
+
+func TestBigExponentLimit(t *testing.T) {
+	// Без ограничения порядка каждое из этих выражений минутами печаталось бы в Float.Text
+	tests := []string{
+		"exp(1000000000)",
+		"10^100000000",
+		"sqrt(2)^(10^9)",
+		"exp(-1e9)",
+		"1 // 1e-300000000",
+		"2^(1e12 + 0.5)",
+		"2^(-1e12 + 0.5)",
+	}
+
+	for _, expr := range tests {
+		start := time.Now()
+		_, err := evaluateBig(expr, nil, BigConfig{})
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != ErrDomain {
+			t.Errorf("evaluateBig(%q) error = %v, expected domain error", expr, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("evaluateBig(%q) took %v", expr, elapsed)
+		}
+	}
+}
+
+// Литерал вне диапазона — ошибка в его месте: 1e-1000000000 не должен молча становиться нулём
+func TestBigLiteralRange(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{"ln(1e-1000000000)", 3},
+		{"1 // 1e-300000000", 5},
+		{"1e-99999999999999999999 + 1", 0},
+		{"2 * 1e1000000000", 4},
+	}
+
+	for _, tt := range tests {
+		_, err := evaluateBig(tt.expr, nil, BigConfig{})
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != ErrDomain || calcErr.Pos != tt.pos {
+			t.Errorf("evaluateBig(%q) error = %v, expected domain error at %d", tt.expr, err, tt.pos)
+		}
+	}
+	if result, err := evaluateBig("0e-1000000000 + 0.000", nil, BigConfig{}); err != nil || result.String() != "0" {
+		t.Errorf("evaluateBig(0e-1000000000 + 0.000) = %v, %v, expected 0", result, err)
+	}
+}
+
+func TestEvaluateBigErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+	}{
+		{"1 / 0", ErrDivisionByZero},
+		{"0^-2", ErrDivisionByZero},
+		{"(-8)^(1/3)", ErrDomain},
+		{"sqrt(-1)", ErrDomain},
+		{"ln(0)", ErrDomain},
+		{"log(1, 5)", ErrDomain},
+		{"y", ErrUndefinedVariable},
+		{"1 % 0", ErrDivisionByZero},
+		{"1 // (2 - 2)", ErrDivisionByZero},
+		{"exp(1e10) - exp(1e10)", ErrDomain},
+		{"0 * exp(1e10)", ErrDomain},
+		{"2^(2^40) * 0", ErrDomain},
+		{"exp(1e10) / exp(1e10)", ErrDomain},
+		{"sin(exp(1e10))", ErrDomain},
+		{"sin(2^1000000)", ErrDomain},
+		{"1e999999999999 - 1e999999999999", ErrDomain},
+		{"exp(-1e10)", ErrDomain},
+		{"2^65536", ErrDomain},
+		{"1e20000", ErrDomain},
+	}
+
+	for _, tt := range tests {
+		_, err := evaluateBig(tt.expr, nil, BigConfig{})
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code {
+			t.Errorf("evaluateBig(%q) error = %v, expected code %d", tt.expr, err, tt.code)
+		}
+	}
+}
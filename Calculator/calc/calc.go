@@ -0,0 +1,664 @@
+package calc
+
+// unaryMinus — оператор смены знака в постфиксной записи.
+// В инфиксной записи он выглядит как обычный "-", но стоит перед операндом.
+const unaryMinus = "u-"
+
+// unitTimes — неявное умножение на единицу измерения (5 m) на стеке операторов. Оно связывает сильнее * и /,
+// но слабее ^, а в выход попадает обычным "*".
+const unitTimes = "u*"
+
+// Префиксные логические операторы: ! — отрицание, !! — приведение к 0 или 1.
+// !! встречается только в постфиксной записи, им заканчиваются правые части && и ||.
+const (
+	logicalNot = "!"
+	toBoolean  = "!!"
+)
+
+// compareResult переводит результат сравнения (-1, 0 или 1, как у big.Rat.Cmp) в значение оператора op.
+func compareResult(op string, c int) bool {
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// infixToPostfix преобразует список токенов из инфиксной записи в постфиксную (обратную польскую запись)
+// Знаки "+" и "-" в начале выражения, после "(", "," или после другого оператора считаются унарными:
+// унарный минус превращается в оператор unaryMinus, унарный плюс просто отбрасывается.
+// Вызов функции записывается после своих аргументов токеном TokenCall с числом аргументов: "max(1, 2, 3)" → [1 2 3 max(3)].
+// Список [1, 2, 3] бывает только аргументом функции с любым числом аргументов, его элементы становятся её аргументами:
+// "sum([1, 2], 3)" → [1 2 3 sum(3)], поэтому вычислителям списки не видны.
+// Токены постфиксной записи сохраняют свои позиции, ошибки возвращаются как *CalcError.
+// Известны только встроенные функции и операторы; функции пользователя и свои операторы понимает infixToPostfixWith.
+//
+// Условное выражение и логические операторы вычисляются сокращённо, поэтому записываются переходами:
+//
+//	c ? a : b  →  c ?[n] a :[m] b       (?[n] снимает условие и, если оно ложно, пропускает n токенов)
+//	a && b     →  a ?[n] b !! :[1] 0
+//	a || b     →  a ?[2] 1 :[m] b !!
+//
+// Знак % после операнда, за которым не идёт следующий операнд (число, имя или скобка), — процент, а не остаток.
+// Процент раскрывается в деление на 100, а правая часть сложения и вычитания, целиком записанная процентом,
+// считается процентом от левой части, как на калькуляторе. На 100 там делится последним, чтобы не копить
+// ошибку округления: 0.15 в двоичной записи неточно, а 200 * 115 / 100 — ровно 230.
+//
+//	15%         →  15 100 /                  (0.15)
+//	200 + 15%   →  200 15 100 + * 100 /      (200 * (100 + 15) / 100 = 230)
+//	200 - 15%   →  200 15 u- 100 + * 100 /   (200 * (100 - 15) / 100 = 170)
+//	200 * 15%   →  200 15 100 / *            (30)
+//
+// Остаток от отрицательного числа записывается как 7 mod -3 или 7 % (-3): в 7 % -3 знак % — процент.
+func infixToPostfix(tokens []Token) ([]Token, error) {
+	return infixToPostfixWith(tokens, builtinFunction, builtinOperators)
+}
+
+// startsOperand сообщает, начинается ли с первого из tokens операнд: число, имя или скобка.
+func startsOperand(tokens []Token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	switch tokens[0].Kind {
+	case TokenNumber, TokenImag, TokenIdent, TokenUnit, TokenLParen:
+		return true
+	}
+	return false
+}
+
+// infixToPostfixWith — infixToPostfix, в котором функции ищутся через resolve, а операторы — в наборе ops.
+func infixToPostfixWith(tokens []Token, resolve resolver, ops *OperatorSet) ([]Token, error) {
+
+	var output []Token  // ОПЗ
+	var opStack []Token // стэк-операторов
+	var argCount []int  // число аргументов внутри каждой открытой скобки и элементов внутри каждого списка
+
+	expectOperand := true // ждём ли мы сейчас операнд (число или открывающую скобку)
+	percent := -1         // длина выхода сразу после последнего процента: по ней + и - узнают процент справа
+
+	// topKind возвращает вид токена на вершине стека операторов, offset — сколько токенов пропустить сверху
+	topKind := func(offset int) TokenKind {
+		if len(opStack) <= offset {
+			return TokenInvalid
+		}
+		return opStack[len(opStack)-1-offset].Kind
+	}
+	pop := func() Token {
+		last := opStack[len(opStack)-1]
+		opStack = opStack[:len(opStack)-1]
+		return last
+	}
+
+	// synth добавляет в выход токен, которого нет в исходной строке; место у него — как у оператора at
+	synth := func(kind TokenKind, text string, at Token) int {
+		output = append(output, Token{Kind: kind, Text: text, Pos: at.Pos, End: at.End})
+		return len(output) - 1
+	}
+	// patch направляет переход с номером i на текущий конец выхода
+	patch := func(i int) {
+		output[i].Argc = len(output) - i - 1
+	}
+
+	// emit переносит снятый со стека оператор в выход. ?, : и логические операторы лежат на стеке
+	// вместе с номером своего незавершённого перехода в Argc: их снятие завершает переход.
+	emit := func(op Token) error {
+		switch {
+		case op.Kind == TokenQuestion:
+			return errorAt(ErrConditional, op, "после ? пропущено :")
+		case op.Kind == TokenColon:
+			patch(op.Argc)
+			percent = -1 // выход не вырос, но процент остался внутри ветки: 200 + (c ? 1 : 15%) — не процент от 200
+		case op.Text == "&&":
+			synth(TokenOperator, toBoolean, op)
+			end := synth(TokenJump, ":", op)
+			patch(op.Argc)
+			output[synth(TokenNumber, "0", op)].Value = 0
+			patch(end)
+		case op.Text == "||":
+			synth(TokenOperator, toBoolean, op)
+			patch(op.Argc)
+		case op.Text == unitTimes:
+			op.Text = "*"
+			output = append(output, op)
+		case (op.Text == "+" || op.Text == "-") && len(output) == percent:
+			// x ± y% = x * (100 ± y) / 100: процент берётся от левой части. Деление процента на 100
+			// только что записано в выход последним — снимаем его, нужно само y
+			output = output[:len(output)-2]
+			if op.Text == "-" {
+				synth(TokenOperator, unaryMinus, op)
+			}
+			output[synth(TokenNumber, "100", op)].Value = 100
+			synth(TokenOperator, "+", op)
+			op.Text = "*"
+			output = append(output, op)
+			output[synth(TokenNumber, "100", op)].Value = 100
+			synth(TokenOperator, "/", op)
+		default:
+			output = append(output, op)
+		}
+		return nil
+	}
+	// emitWhile выталкивает операторы, пока для вершины стека выполняется cond
+	emitWhile := func(cond func(top Token) bool) error {
+		for len(opStack) > 0 && cond(opStack[len(opStack)-1]) {
+			if err := emit(pop()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	notOpen := func(top Token) bool { return top.Kind != TokenLParen && top.Kind != TokenLBracket }
+
+	// precedence — приоритет оператора на стеке; unitTimes связывает на ступень сильнее *
+	unitPrecedence := ops.precedence("*") + 1
+	precedence := func(top Token) int {
+		if top.Text == unitTimes {
+			return unitPrecedence
+		}
+		return ops.precedence(top.Text)
+	}
+
+	// pushBinary кладёт в стек бинарный оператор после его левого операнда
+	pushBinary := func(token Token) error {
+		// Для оператора проверяем приоритет и выталкиваем операторы из стека.
+		// Левоассоциативный оператор выталкивает операторы с тем же приоритетом, правоассоциативный — нет.
+		op, _ := ops.binaryOp(token.Text)
+		err := emitWhile(func(top Token) bool {
+			if top.Kind != TokenOperator {
+				return false
+			}
+			p := precedence(top)
+			return p > op.Precedence || p == op.Precedence && !op.RightAssoc
+		})
+		if err != nil {
+			return err
+		}
+
+		// Левая часть && и || уже в выходе: начинаем переход в обход правой части
+		switch token.Text {
+		case "&&":
+			token.Argc = synth(TokenJumpIfFalse, "&&", token)
+		case "||":
+			jump := synth(TokenJumpIfFalse, "||", token)
+			output[synth(TokenNumber, "1", token)].Value = 1
+			token.Argc = synth(TokenJump, ":", token)
+			patch(jump)
+		}
+		opStack = append(opStack, token)
+		expectOperand = true
+		return nil
+	}
+
+	// isPrefix сообщает, может ли оператор стоять перед операндом. Унарный плюс ничего не делает
+	isPrefix := func(token Token) bool {
+		_, ok := ops.prefixOp(token.Text)
+		return token.Kind == TokenOperator && (ok || token.Text == "+")
+	}
+
+	for i, token := range tokens {
+
+		_, isBinary := ops.binaryOp(token.Text)
+		if canonical, ok := operatorAliases[token.Text]; ok && token.Kind == TokenOperator {
+			token.Text, isBinary = canonical, true // "**" — просто другое написание степени
+		}
+		isPercent := token.Kind == TokenOperator && tokens[i].Text == "%" && !expectOperand && !startsOperand(tokens[i+1:])
+		// Префиксный оператор, который не бывает бинарным, начинает операнд
+		isOperand := token.Kind == TokenNumber || token.Kind == TokenImag || token.Kind == TokenIdent || token.Kind == TokenLParen ||
+			token.Kind == TokenLBracket || token.Kind == TokenUnit || isPrefix(token) && !isBinary
+		if token.Kind == TokenUnit && !expectOperand {
+			// Единица сразу после операнда — неявное умножение, которое держит число и единицу вместе:
+			// 10 m / 2 s = (10 m) / (2 s), но 5 m^2 = 5 * m^2
+			err := emitWhile(func(top Token) bool {
+				return top.Kind == TokenOperator && precedence(top) >= unitPrecedence
+			})
+			if err != nil {
+				return nil, err
+			}
+			opStack = append(opStack, Token{Kind: TokenOperator, Text: unitTimes, Pos: token.Pos, End: token.End})
+		} else if isOperand && !expectOperand {
+			return nil, errorAt(ErrMissingOperator, token, "пропущен оператор перед %s", token.Text)
+		}
+		isCall := token.Kind == TokenIdent && i+1 < len(tokens) && tokens[i+1].Kind == TokenLParen
+
+		switch {
+		case token.Kind == TokenNumber || token.Kind == TokenImag || token.Kind == TokenUnit:
+			output = append(output, token) // если число или единица - добавляем
+			expectOperand = false
+
+		case token.Kind == TokenIdent && !isCall:
+			output = append(output, token) // имя без скобок - переменная, её значение найдётся при вычислении
+			expectOperand = false
+
+		case token.Kind == TokenIdent:
+			if _, ok := resolve(token.Text); !ok {
+				return nil, errorAt(ErrUnknownFunction, token, "неизвестная функция: %s", token.Text)
+			}
+			// Имя функции ждёт в стеке под своей открывающей скобкой
+			opStack = append(opStack, token)
+
+		case token.Kind == TokenLParen:
+			opStack = append(opStack, token)
+			argCount = append(argCount, 1)
+			expectOperand = true
+
+		case expectOperand && isPrefix(token):
+			// Префиксный оператор относится к следующему операнду, поэтому ничего не выталкиваем
+			if token.Text != "+" {
+				token.Text = postfixText(token.Text)
+				opStack = append(opStack, token)
+			}
+
+		case token.Kind == TokenComma:
+
+			// Аргумент закончился: выталкиваем его операторы до открывающей скобки
+			if err := emitWhile(notOpen); err != nil {
+				return nil, err
+			}
+			inList := topKind(0) == TokenLBracket
+			if !inList && topKind(1) != TokenIdent {
+				return nil, errorAt(ErrMisplacedComma, token, "запятая вне вызова функции")
+			}
+			if expectOperand && inList {
+				return nil, errorAt(ErrMissingOperand, token, "пропущен элемент списка")
+			}
+			if expectOperand {
+				return nil, errorAt(ErrMissingOperand, token, "пропущен аргумент функции %s", opStack[len(opStack)-2].Text)
+			}
+			argCount[len(argCount)-1]++
+			expectOperand = true
+
+		case token.Kind == TokenRParen:
+
+			emptyCall := i > 0 && tokens[i-1].Kind == TokenLParen
+
+			// Извлекаем операторы до открывающей скобки справа налево
+			if err := emitWhile(notOpen); err != nil {
+				return nil, err
+			}
+			if topKind(0) != TokenLParen {
+				return nil, errorAt(ErrMismatchedParen, token, "не совпадают скобки") // Обработаем ошибку на тупого со скобками
+			}
+			pop()
+
+			argc := argCount[len(argCount)-1]
+			argCount = argCount[:len(argCount)-1]
+
+			// Если скобка принадлежала вызову функции, записываем сам вызов
+			if topKind(0) == TokenIdent {
+				call := pop()
+				if emptyCall {
+					argc = 0
+				} else if expectOperand {
+					return nil, errorAt(ErrMissingOperand, token, "пропущен аргумент функции %s", call.Text)
+				}
+				f, _ := resolve(call.Text)
+				if err := checkArity(call.Text, f, argc); err != nil {
+					return nil, errorAt(ErrArity, call, "%v", err)
+				}
+				call.Kind = TokenCall
+				call.Argc = argc
+				output = append(output, call)
+			} else if expectOperand {
+				return nil, errorAt(ErrMissingOperand, token, "пропущен операнд перед )")
+			}
+			expectOperand = false
+
+		case token.Kind == TokenLBracket:
+			// Список — только целый аргумент функции с любым числом аргументов или элемент другого списка
+			inCall := topKind(0) == TokenLParen && topKind(1) == TokenIdent
+			if inCall {
+				if f, _ := resolve(opStack[len(opStack)-2].Text); f.maxArgs >= 0 {
+					return nil, errorAt(ErrMisplacedList, token, "функция %s не принимает список", opStack[len(opStack)-2].Text)
+				}
+			} else if topKind(0) != TokenLBracket {
+				return nil, errorAt(ErrMisplacedList, token, "список может быть только аргументом функции: sum([1, 2, 3])")
+			}
+			opStack = append(opStack, token)
+			argCount = append(argCount, 1)
+			expectOperand = true
+
+		case token.Kind == TokenRBracket:
+
+			emptyList := i > 0 && tokens[i-1].Kind == TokenLBracket
+
+			if err := emitWhile(notOpen); err != nil {
+				return nil, err
+			}
+			if topKind(0) != TokenLBracket {
+				return nil, errorAt(ErrMismatchedParen, token, "не совпадают скобки")
+			}
+			pop()
+
+			n := argCount[len(argCount)-1]
+			argCount = argCount[:len(argCount)-1]
+			if emptyList {
+				n = 0
+			} else if expectOperand {
+				return nil, errorAt(ErrMissingOperand, token, "пропущен элемент списка")
+			}
+			if i+1 < len(tokens) {
+				if next := tokens[i+1].Kind; next != TokenComma && next != TokenRParen && next != TokenRBracket {
+					return nil, errorAt(ErrMisplacedList, tokens[i+1], "после списка ожидается запятая или скобка")
+				}
+			}
+			// Элементы списка становятся аргументами вызова (или элементами внешнего списка) вместо самого списка
+			argCount[len(argCount)-1] += n - 1
+			expectOperand = false
+
+		case token.Kind == TokenQuestion:
+			if expectOperand {
+				return nil, errorAt(ErrMissingOperand, token, "пропущено условие перед ?")
+			}
+			// Условие закончилось. Начатые ранее условные выражения остаются на стеке: они правоассоциативны
+			err := emitWhile(func(top Token) bool { return top.Kind == TokenOperator })
+			if err != nil {
+				return nil, err
+			}
+			token.Argc = synth(TokenJumpIfFalse, "?", token)
+			opStack = append(opStack, token)
+			expectOperand = true
+
+		case token.Kind == TokenColon:
+			if expectOperand {
+				return nil, errorAt(ErrMissingOperand, token, "пропущен операнд перед :")
+			}
+			// Закрываем вложенные условные выражения ветки "да" и находим свой ?
+			err := emitWhile(func(top Token) bool { return top.Kind == TokenOperator || top.Kind == TokenColon })
+			if err != nil {
+				return nil, err
+			}
+			if topKind(0) != TokenQuestion {
+				return nil, errorAt(ErrConditional, token, ": без ?")
+			}
+			question := pop()
+			token.Argc = synth(TokenJump, ":", token)
+			patch(question.Argc)
+			opStack = append(opStack, token)
+			expectOperand = true
+
+		case isPercent:
+			// Процент относится к только что записанному операнду: 15% = 15 / 100
+			output[synth(TokenNumber, "100", token)].Value = 100
+			synth(TokenOperator, "/", token)
+			percent = len(output)
+
+		case token.Kind == TokenOperator && isBinary:
+			if expectOperand {
+				return nil, errorAt(ErrMissingOperand, token, "пропущен операнд перед %s", token.Text)
+			}
+			if err := pushBinary(token); err != nil {
+				return nil, err
+			}
+
+		default:
+			return nil, errorAt(ErrUnknownToken, token, "неизвестный токен: %s", token.Text)
+		}
+	}
+
+	if expectOperand && len(tokens) > 0 {
+		last := tokens[len(tokens)-1]
+		return nil, &CalcError{Code: ErrMissingOperand, Pos: last.End, End: last.End + 1, Msg: "выражение оборвано: пропущен операнд"}
+	}
+
+	// Добавляем оставшиеся операторы в выходной список
+	for len(opStack) > 0 {
+		last := pop()
+		if last.Kind == TokenLParen || last.Kind == TokenLBracket {
+			return nil, errorAt(ErrMismatchedParen, last, "не совпадают скобки") // Снова ошибка на тупого
+		}
+		if err := emit(last); err != nil {
+			return nil, err
+		}
+	}
+
+	return output, nil
+}
+
+// toPostfix разбирает строку выражения сразу в постфиксную запись.
+func toPostfix(expr string) ([]Token, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return infixToPostfix(tokens)
+}
+
+// evaluatePostfix вычисляет значение выражения, заданного в постфиксной записи.
+// Значения переменных берутся из env; неизвестное имя даёт *UndefinedVariableError.
+// Все ошибки возвращаются как *CalcError с позицией токена, на котором вычисление остановилось.
+func evaluatePostfix(postfix []Token, env *Env) (float64, error) {
+	return runPostfix[float64](postfix, env, floatArithmetic{})
+}
+
+// arithmetic — числовая система, в которой вычисляется постфиксная запись: float64, точные дроби и т.д.
+// Работу со стеком runPostfix делает сам, от числовой системы нужны только операции над значениями.
+// Токен передаётся, чтобы ошибка указывала на место в выражении.
+// Логические значения — числа: ложь — ноль, истина — любое другое число, сравнения дают 0 или 1.
+type arithmetic[T any] interface {
+	number(tok Token) (T, error)
+	variable(tok Token, env *Env) (T, error)
+	prefix(tok Token, op *Operator, x T) (T, error)           // унарный минус и префиксные операторы пользователя
+	binary(tok Token, op *Operator, left, right T) (T, error) // оператор — tok.Text, включая сравнения
+	call(tok Token, args []T) (T, error)                      // имя функции — tok.Text
+	truth(x T) bool
+	boolean(b bool) T
+}
+
+// runPostfix вычисляет постфиксную запись в числовой системе arith.
+func runPostfix[T any](postfix []Token, env *Env, arith arithmetic[T]) (T, error) {
+	return runScoped(postfix, env, arith, nil, 0)
+}
+
+// runScoped вычисляет постфиксную запись, в которой имена из params — параметры функции пользователя
+// со значениями аргументов, а depth — глубина вложенных вызовов функций пользователя.
+func runScoped[T any](postfix []Token, env *Env, arith arithmetic[T], params map[string]T, depth int) (T, error) {
+
+	var zero T
+	var stack []T
+
+	for i := 0; i < len(postfix); i++ {
+		token := postfix[i]
+		var result T
+		var err error
+
+		switch token.Kind {
+		case TokenJumpIfFalse:
+
+			// Условие снимается со стека, ложное — переход через ветку, которую вычислять не нужно
+			if len(stack) < 1 {
+				return zero, errorAt(ErrMissingOperand, token, "недостаточно операндов (чисел) для оператора %s", token.Text)
+			}
+			cond := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if !arith.truth(cond) {
+				i += token.Argc
+			}
+			continue
+
+		case TokenJump:
+			i += token.Argc
+			continue
+
+		case TokenNumber, TokenImag, TokenUnit:
+
+			// Если токен число или единица измерения, кладём его в стек.
+			result, err = arith.number(token)
+
+		case TokenIdent:
+
+			if value, ok := params[token.Text]; ok {
+				result = value
+				break
+			}
+			result, err = arith.variable(token, env)
+
+		case TokenCall:
+
+			if len(stack) < token.Argc {
+				return zero, errorAt(ErrMissingOperand, token, "недостаточно операндов (чисел) для функции %s", token.Text)
+			}
+
+			// Аргументы лежат на вершине стека в порядке записи
+			args := stack[len(stack)-token.Argc:]
+			if fn, ok := env.userFunction(token.Text); ok && !isBuiltin(token.Text) {
+				result, err = callUser(token, fn, args, env, arith, depth)
+			} else {
+				result, err = arith.call(token, args)
+			}
+			stack = stack[:len(stack)-token.Argc]
+
+		case TokenOperator:
+
+			op, ok := env.operators().lookup(token.Text)
+			if !ok && token.Text != toBoolean {
+				return zero, errorAt(ErrUnknownToken, token, "неизвестный токен: %s", token.Text)
+			}
+
+			if token.Text == logicalNot || token.Text == toBoolean || op.Prefix {
+				if len(stack) < 1 {
+					return zero, errorAt(ErrMissingOperand, token, "недостаточно операндов (чисел) для оператора %s", prefixSymbol(token.Text))
+				}
+				x := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				if token.Text == logicalNot || token.Text == toBoolean {
+					// Логика одинакова во всех числовых системах
+					result = arith.boolean(arith.truth(x) == (token.Text == toBoolean))
+				} else {
+					result, err = arith.prefix(token, op, x)
+				}
+				break
+			}
+
+			// Проверка наличия двух операндов
+			if len(stack) < 2 {
+				return zero, errorAt(ErrMissingOperand, token, "недостаточно операндов (чисел) для оператора %s", token.Text)
+			}
+
+			// Извлекаем два числа (правый операнд извлекается первым, чтобы сразу подчищать стэк)
+			right := stack[len(stack)-1]
+			left := stack[len(stack)-2]
+			stack = stack[:len(stack)-2]
+			result, err = arith.binary(token, op, left, right)
+
+		default:
+			return zero, errorAt(ErrUnknownToken, token, "неизвестный токен: %s", token.Text)
+		}
+
+		if err != nil {
+			return zero, err
+		}
+		// Результат помещаем обратно в стек.
+		stack = append(stack, result)
+	}
+
+	// После вычисления в стеке должен остаться ровно один элемент — результат.
+	if len(stack) != 1 {
+		return zero, &CalcError{Code: ErrEvaluation, Pos: -1, Msg: "ошибка вычисления выражения"}
+	}
+	return stack[0], nil
+}
+
+// floatArithmetic — обычное вычисление в float64.
+type floatArithmetic struct{}
+
+func (floatArithmetic) number(tok Token) (float64, error) {
+	if err := realOnly(tok); err != nil {
+		return 0, err
+	}
+	return tok.Value, inRange(tok)
+}
+
+func (floatArithmetic) variable(tok Token, env *Env) (float64, error) {
+	return lookupVariable(tok, env, tok.Text)
+}
+
+func (floatArithmetic) prefix(tok Token, op *Operator, x float64) (float64, error) {
+	return applyOperator(tok, op, x)
+}
+
+func (floatArithmetic) binary(tok Token, op *Operator, left, right float64) (float64, error) {
+	return applyOperator(tok, op, left, right)
+}
+
+func (floatArithmetic) call(tok Token, args []float64) (float64, error) {
+	return callFunction(tok, tok.Text, args)
+}
+
+func (floatArithmetic) truth(x float64) bool {
+	return x != 0
+}
+
+func (floatArithmetic) boolean(b bool) float64 {
+	return boolToFloat(b)
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// prefixSymbol возвращает запись префиксного оператора в исходном выражении.
+func prefixSymbol(op string) string {
+	if op == unaryMinus {
+		return "-"
+	}
+	return op
+}
+
+// realOnly запрещает мнимые числа в режимах, где есть только вещественные, и единицы измерения вне режима units.
+func realOnly(tok Token) error {
+	switch tok.Kind {
+	case TokenImag:
+		return imaginaryError(tok)
+	case TokenUnit:
+		return errorAt(ErrDimension, tok, "единицы измерения доступны только в режиме units")
+	}
+	return nil
+}
+
+func imaginaryError(at spanner) error {
+	return errorAt(ErrDomain, at, "мнимые числа доступны только в режиме complex")
+}
+
+// lookupVariable возвращает значение переменной name; at указывает место обращения для ошибки.
+// Комплексная переменная вне режима complex — ошибка, а не молча отброшенная мнимая часть.
+func lookupVariable(at spanner, env *Env, name string) (float64, error) {
+	value, ok := env.Get(name)
+	if !ok {
+		undefined := &UndefinedVariableError{Name: name}
+		err := errorAt(ErrUndefinedVariable, at, "%v", undefined)
+		err.Err = undefined
+		return 0, err
+	}
+	if _, isComplex := env.getComplex(name); isComplex {
+		return 0, errorAt(ErrDomain, at, "значение %s комплексное, оно доступно только в режиме complex", name)
+	}
+	if q, isQuantity := env.getQuantity(name); isQuantity && !q.dim.isZero() {
+		return 0, errorAt(ErrDimension, at, "значение %s имеет размерность %s, оно доступно только в режиме units", name, q.dim)
+	}
+	return value, nil
+}
+
+// callFunction вызывает встроенную функцию name; at указывает место вызова для ошибки.
+func callFunction(at spanner, name string, args []float64) (float64, error) {
+	if err := checkCall(at, name, len(args)); err != nil {
+		return 0, err
+	}
+	result, err := functions[name].apply(args)
+	if err != nil {
+		calcErr := errorAt(ErrDomain, at, "%v", err)
+		calcErr.Err = err
+		return 0, calcErr
+	}
+	return result, nil
+}
@@ -0,0 +1,450 @@
+package calc
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// tokensOf строит токены из готовых строк, расставляя позиции подряд.
+// Строка вида "max(3)" превращается в вызов функции, нераспознанные строки получают TokenInvalid.
+func tokensOf(texts []string) []Token {
+	tokens := make([]Token, len(texts))
+	pos := 0
+	for i, text := range texts {
+		token := Token{Text: text, Pos: pos, End: pos + len([]rune(text))}
+		name, argc, isCall := strings.Cut(strings.TrimSuffix(text, ")"), "(")
+		switch {
+		case text == "(":
+			token.Kind = TokenLParen
+		case text == ")":
+			token.Kind = TokenRParen
+		case text == ",":
+			token.Kind = TokenComma
+		case builtinOperators.isSymbol(text) || text == unaryMinus:
+			token.Kind = TokenOperator
+		case isCall && name != "":
+			token.Kind, token.Text = TokenCall, name
+			token.Argc, _ = strconv.Atoi(argc)
+		case isIdentStart([]rune(text)[0]):
+			token.Kind = TokenIdent
+		default:
+			if value, err := strconv.ParseFloat(text, 64); err == nil {
+				token.Kind, token.Value = TokenNumber, value
+			}
+		}
+		tokens[i] = token
+		pos = token.End + 1
+	}
+	return tokens
+}
+
+// pipelines — два способа вычислить выражение: через постфиксную запись и через синтаксическое дерево.
+// Тесты вычислений прогоняются через оба, результаты должны совпадать.
+var pipelines = []struct {
+	name string
+	eval func(expr string, env *Env) (float64, error)
+}{
+	{"postfix", func(expr string, env *Env) (float64, error) {
+		postfix, err := toPostfix(expr)
+		if err != nil {
+			return 0, err
+		}
+		return evaluatePostfix(postfix, env)
+	}},
+	{"tree", func(expr string, env *Env) (float64, error) {
+		tree, err := ParseTree(expr)
+		if err != nil {
+			return 0, err
+		}
+		return evalTree(tree, env)
+	}},
+}
+
+// textsOf возвращает тексты токенов, чтобы сравнивать их с ожидаемыми строками.
+func textsOf(tokens []Token) []string {
+	if tokens == nil {
+		return nil
+	}
+	texts := make([]string, len(tokens))
+	for i, token := range tokens {
+		texts[i] = token.String()
+	}
+	return texts
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"3+4", []string{"3", "+", "4"}},
+		{"(1 + 2) * 3", []string{"(", "1", "+", "2", ")", "*", "3"}},
+		{"10 / (5 - 3)", []string{"10", "/", "(", "5", "-", "3", ")"}},
+		{" 3 + 4.5 ", []string{"3", "+", "4.5"}},
+		{"2**3", []string{"2", "**", "3"}},
+		{"2 * * 3", []string{"2", "*", "*", "3"}},
+		{"max(x1, 2)", []string{"max", "(", "x1", ",", "2", ")"}},
+		{"sqrt(16)+_a", []string{"sqrt", "(", "16", ")", "+", "_a"}},
+		{"sum([1,2])", []string{"sum", "(", "[", "1", ",", "2", "]", ")"}},
+	}
+
+	for _, tc := range tests {
+		tokens, err := tokenize(tc.input)
+		if err != nil {
+			t.Errorf("tokenize(%q) unexpected error: %v", tc.input, err)
+			continue
+		}
+		result := textsOf(tokens)
+		if !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("tokenize(%q) = %v, ожидалось %v", tc.input, result, tc.expected)
+		}
+	}
+}
+
+func TestInfixToPostfix(t *testing.T) {
+	tests := []struct {
+		input    []string
+		expected []string
+		hasError bool
+	}{
+		{[]string{"3", "+", "4"}, []string{"3", "4", "+"}, false},
+		{[]string{"(", "1", "+", "2", ")", "*", "3"}, []string{"1", "2", "+", "3", "*"}, false},
+		{[]string{"10", "/", "(", "5", "-", "3", ")"}, []string{"10", "5", "3", "-", "/"}, false},
+		{[]string{"(", "3", "+", "4"}, nil, true}, // Несовпадение скобок
+		{[]string{"3", "+", "@"}, nil, true},      // Неизвестный символ
+	}
+
+	for _, tt := range tests {
+		result, err := infixToPostfix(tokensOf(tt.input))
+		if (err != nil) != tt.hasError {
+			t.Errorf("infixToPostfix(%v) error = %v, expected error: %v", tt.input, err, tt.hasError)
+		}
+		if err == nil && !reflect.DeepEqual(textsOf(result), tt.expected) {
+			t.Errorf("infixToPostfix(%v) = %v, expected %v", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestEvaluatePostfix(t *testing.T) {
+	tests := []struct {
+		input    []string
+		expected float64
+		hasError bool
+	}{
+		{[]string{"3", "4", "+"}, 7.0, false},
+		{[]string{"10", "5", "/", "2", "*"}, 4.0, false},
+		{[]string{"2", "3", "+", "4", "*"}, 20.0, false},
+		{[]string{"3", "0", "/"}, 0, true}, // Деление на ноль
+		{[]string{"3", "+"}, 0, true},      // Недостаточно операндов
+	}
+
+	for _, tt := range tests {
+		result, err := evaluatePostfix(tokensOf(tt.input), nil)
+		if (err != nil) != tt.hasError {
+			t.Errorf("evaluatePostfix(%v) error = %v, expected error: %v", tt.input, err, tt.hasError)
+		}
+		if err == nil && result != tt.expected {
+			t.Errorf("evaluatePostfix(%v) = %v, expected %v", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestFullEvaluation(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected float64
+		hasError bool
+	}{
+		{"3 + 4", 7.0, false},
+		{"(1 + 2) * 3", 9.0, false},
+		{"10 / (5 - 3)", 5.0, false},
+		{"3 + (4 * 2 - ( 3 * 4 ) / 2) - 7 / 2", 1.5, false},
+		{"3 +", 0, true},         // Ошибка
+		{"(3 + 2", 0, true},      // Скобки
+		{"3 / 0", 0, true},       // Деление на ноль
+		{"3 + unknown", 0, true}, // Неизвестный токен
+	}
+
+	for _, p := range pipelines {
+		for _, tt := range tests {
+			result, err := p.eval(tt.expr, nil)
+			if (err != nil) != tt.hasError {
+				t.Errorf("%s(%q) error = %v, expected error: %v", p.name, tt.expr, err, tt.hasError)
+			}
+			if err == nil && result != tt.expected {
+				t.Errorf("%s(%q) = %v, expected %v", p.name, tt.expr, result, tt.expected)
+			}
+		}
+	}
+}
+
+func TestUnarySigns(t *testing.T) {
+	tests := []struct {
+		expr     string
+		postfix  []string
+		expected float64
+	}{
+		{"-3 + 4", []string{"3", unaryMinus, "4", "+"}, 1},
+		{"2 * -5", []string{"2", "5", unaryMinus, "*"}, -10},
+		{"-(1+2)", []string{"1", "2", "+", unaryMinus}, -3},
+		{"--3", []string{"3", unaryMinus, unaryMinus}, 3},
+		{"-+-3", []string{"3", unaryMinus, unaryMinus}, 3},
+		{"+3", []string{"3"}, 3},
+		{"3 - -2", []string{"3", "2", unaryMinus, "-"}, 5},
+		{"-2 * 3", []string{"2", unaryMinus, "3", "*"}, -6},
+		{"-(-(2))", []string{"2", unaryMinus, unaryMinus}, 2},
+		{"(-3) * (+4)", []string{"3", unaryMinus, "4", "*"}, -12},
+		{"10 / -(4 - 2)", []string{"10", "4", "2", "-", unaryMinus, "/"}, -5},
+	}
+
+	for _, tt := range tests {
+		postfix, err := toPostfix(tt.expr)
+		if err != nil {
+			t.Errorf("infixToPostfix(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(textsOf(postfix), tt.postfix) {
+			t.Errorf("infixToPostfix(%q) = %v, expected %v", tt.expr, postfix, tt.postfix)
+		}
+		for _, p := range pipelines {
+			result, err := p.eval(tt.expr, nil)
+			if err != nil {
+				t.Errorf("%s(%q) unexpected error: %v", p.name, tt.expr, err)
+				continue
+			}
+			if result != tt.expected {
+				t.Errorf("%s(%q) = %v, expected %v", p.name, tt.expr, result, tt.expected)
+			}
+		}
+	}
+}
+
+func TestPower(t *testing.T) {
+	tests := []struct {
+		expr     string
+		postfix  []string
+		expected float64
+	}{
+		{"2^3", []string{"2", "3", "^"}, 8},
+		{"2**3", []string{"2", "3", "^"}, 8},
+		{"2^3^2", []string{"2", "3", "2", "^", "^"}, 512},
+		{"2**3**2", []string{"2", "3", "2", "^", "^"}, 512},
+		{"(2^3)^2", []string{"2", "3", "^", "2", "^"}, 64},
+		{"-2^2", []string{"2", "2", "^", unaryMinus}, -4},
+		{"(-2)^2", []string{"2", unaryMinus, "2", "^"}, 4},
+		{"2^-2", []string{"2", "2", unaryMinus, "^"}, 0.25},
+		{"2 * 3^2", []string{"2", "3", "2", "^", "*"}, 18},
+		{"8 / 2 / 2", []string{"8", "2", "/", "2", "/"}, 2},
+		{"10 - 4 - 3", []string{"10", "4", "-", "3", "-"}, 3},
+	}
+
+	for _, tt := range tests {
+		postfix, err := toPostfix(tt.expr)
+		if err != nil {
+			t.Errorf("infixToPostfix(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(textsOf(postfix), tt.postfix) {
+			t.Errorf("infixToPostfix(%q) = %v, expected %v", tt.expr, postfix, tt.postfix)
+		}
+		for _, p := range pipelines {
+			result, err := p.eval(tt.expr, nil)
+			if err != nil {
+				t.Errorf("%s(%q) unexpected error: %v", p.name, tt.expr, err)
+				continue
+			}
+			if result != tt.expected {
+				t.Errorf("%s(%q) = %v, expected %v", p.name, tt.expr, result, tt.expected)
+			}
+		}
+	}
+}
+
+func TestComparisonsAndLogic(t *testing.T) {
+	tests := []struct {
+		expr     string
+		postfix  []string
+		expected float64
+	}{
+		{"1 + 2 == 3", []string{"1", "2", "+", "3", "=="}, 1},
+		{"2 * 3 != 6", []string{"2", "3", "*", "6", "!="}, 0},
+		{"1 < 2", []string{"1", "2", "<"}, 1},
+		{"2 <= 2", []string{"2", "2", "<="}, 1},
+		{"1 > 2", []string{"1", "2", ">"}, 0},
+		{"3 >= 4 - 1", []string{"3", "4", "1", "-", ">="}, 1},
+		{"!0", []string{"0", "!"}, 1},
+		{"!5", []string{"5", "!"}, 0},
+		{"!!5", []string{"5", "!", "!"}, 1},
+		{"-!0", []string{"0", "!", unaryMinus}, -1},
+		{"1 && 2", []string{"1", "&&[3]", "2", "!!", ":[1]", "0"}, 1},
+		{"0 && 2", []string{"0", "&&[3]", "2", "!!", ":[1]", "0"}, 0},
+		{"0 || 5", []string{"0", "||[2]", "1", ":[2]", "5", "!!"}, 1},
+		{"0 || 0", []string{"0", "||[2]", "1", ":[2]", "0", "!!"}, 0},
+		{"1 < 0 || 2 > 1 && 0 == 1", []string{"1", "0", "<", "||[2]", "1", ":[11]",
+			"2", "1", ">", "&&[5]", "0", "1", "==", "!!", ":[1]", "0", "!!"}, 0},
+		{"!(1 && 0) == 1", []string{"1", "&&[3]", "0", "!!", ":[1]", "0", "!", "1", "=="}, 1},
+	}
+
+	for _, tt := range tests {
+		postfix, err := toPostfix(tt.expr)
+		if err != nil {
+			t.Errorf("infixToPostfix(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(textsOf(postfix), tt.postfix) {
+			t.Errorf("infixToPostfix(%q) = %v, expected %v", tt.expr, textsOf(postfix), tt.postfix)
+		}
+		for _, p := range pipelines {
+			result, err := p.eval(tt.expr, nil)
+			if err != nil {
+				t.Errorf("%s(%q) unexpected error: %v", p.name, tt.expr, err)
+				continue
+			}
+			if result != tt.expected {
+				t.Errorf("%s(%q) = %v, expected %v", p.name, tt.expr, result, tt.expected)
+			}
+		}
+	}
+}
+
+func TestConditional(t *testing.T) {
+	env := NewEnv()
+	env.Set("x", 0)
+	env.Set("income", 50000)
+
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"1 ? 2 : 3", 2},
+		{"0 ? 2 : 3", 3},
+		{"1 ? 2 : 3 + 10", 2},
+		{"(0 ? 2 : 3) + 10", 13},
+		{"0 ? 1 : 0 ? 2 : 3", 3},
+		{"1 ? 0 ? 4 : 5 : 6", 5},
+		{"income <= 10000 ? 0 : income <= 40000 ? (income - 10000) * 0.1 : 3000 + (income - 40000) * 0.2", 5000},
+		{"max(x > 0 ? 1 : 2, 0)", 2},
+		// Ненужная ветка и правая часть && и || не вычисляются
+		{"x != 0 && 1/x > 2", 0},
+		{"x == 0 || 1/x > 2", 1},
+		{"x == 0 ? 0 : 1/x", 0},
+		{"x != 0 ? 1/x : sqrt(-1) == sqrt(-1)", 0},
+	}
+
+	for _, p := range pipelines {
+		for _, tt := range tests {
+			result, err := p.eval(tt.expr, env)
+			if err != nil {
+				t.Errorf("%s(%q) unexpected error: %v", p.name, tt.expr, err)
+				continue
+			}
+			if result != tt.expected {
+				t.Errorf("%s(%q) = %v, expected %v", p.name, tt.expr, result, tt.expected)
+			}
+		}
+	}
+}
+
+func TestConditionalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+		pos  int
+	}{
+		{"1 ? 2", ErrConditional, 2},
+		{"1 : 2", ErrConditional, 2},
+		{"(1 ? 2) : 3", ErrConditional, 3},
+		{"1 ? : 2", ErrMissingOperand, 4},
+		{"1 & 2", ErrUnknownToken, 2},
+		{"1 &&", ErrMissingOperand, 4},
+		{"1 / 0 > 0 || 1", ErrDivisionByZero, 2},
+	}
+
+	for _, p := range pipelines {
+		for _, tt := range tests {
+			_, err := p.eval(tt.expr, nil)
+			var calcErr *CalcError
+			if !errors.As(err, &calcErr) || calcErr.Code != tt.code || calcErr.Pos != tt.pos {
+				t.Errorf("%s(%q) error = %#v, expected %v at %d", p.name, tt.expr, err, tt.code, tt.pos)
+			}
+		}
+	}
+}
+
+func TestModuloAndPercent(t *testing.T) {
+	tests := []struct {
+		expr     string
+		postfix  []string
+		expected float64
+	}{
+		{"7 % 3", []string{"7", "3", "%"}, 1},
+		{"7 mod 3", []string{"7", "3", "%"}, 1},
+		{"-7 % 2", []string{"7", unaryMinus, "2", "%"}, 1},
+		{"7 mod -2", []string{"7", "2", unaryMinus, "%"}, -1},
+		{"7.5 % 2", []string{"7.5", "2", "%"}, 1.5},
+		{"7 // 2", []string{"7", "2", "//"}, 3},
+		{"-7 // 2", []string{"7", unaryMinus, "2", "//"}, -4},
+		{"1 + 7 // 2 * 2", []string{"1", "7", "2", "//", "2", "*", "+"}, 7},
+		{"2 * 7 % 4", []string{"2", "7", "*", "4", "%"}, 2},
+		{"15%", []string{"15", "100", "/"}, 0.15},
+		{"200 * 15%", []string{"200", "15", "100", "/", "*"}, 30},
+		{"200 + 15%", []string{"200", "15", "100", "+", "*", "100", "/"}, 230},
+		{"200 - 15%", []string{"200", "15", unaryMinus, "100", "+", "*", "100", "/"}, 170},
+		{"100 + 10% + 10%", []string{"100", "10", "100", "+", "*", "100", "/", "10", "100", "+", "*", "100", "/"}, 121},
+		{"1000 - 1%", []string{"1000", "1", unaryMinus, "100", "+", "*", "100", "/"}, 990},
+		{"200 + 50%%", []string{"200", "50", "100", "/", "100", "+", "*", "100", "/"}, 201},
+		{"200 + 15% * 2", []string{"200", "15", "100", "/", "2", "*", "+"}, 200.3},
+		{"7 % (-3)", []string{"7", "3", unaryMinus, "%"}, -2},
+		{"50% % 3", []string{"50", "100", "/", "3", "%"}, 0.5},
+		{"200 + (0 ? 1 : 15%)", []string{"200", "0", "?[2]", "1", ":[3]", "15", "100", "/", "+"}, 200.15},
+		{"200 + +15%", []string{"200", "15", "100", "+", "*", "100", "/"}, 230},
+	}
+
+	for _, tt := range tests {
+		postfix, err := toPostfix(tt.expr)
+		if err != nil {
+			t.Errorf("infixToPostfix(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(textsOf(postfix), tt.postfix) {
+			t.Errorf("infixToPostfix(%q) = %v, expected %v", tt.expr, textsOf(postfix), tt.postfix)
+		}
+		for _, p := range pipelines {
+			result, err := p.eval(tt.expr, nil)
+			if err != nil {
+				t.Errorf("%s(%q) unexpected error: %v", p.name, tt.expr, err)
+				continue
+			}
+			if result != tt.expected {
+				t.Errorf("%s(%q) = %v, expected %v", p.name, tt.expr, result, tt.expected)
+			}
+		}
+	}
+}
+
+func TestModuloErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+		pos  int
+	}{
+		{"5 % 0", ErrDivisionByZero, 2},
+		{"5 mod (1 - 1)", ErrDivisionByZero, 2},
+		{"1 + 5 // 0", ErrDivisionByZero, 6},
+		{"%", ErrMissingOperand, 0},
+		{"5 //", ErrMissingOperand, 4},
+	}
+
+	for _, p := range pipelines {
+		for _, tt := range tests {
+			_, err := p.eval(tt.expr, nil)
+			var calcErr *CalcError
+			if !errors.As(err, &calcErr) || calcErr.Code != tt.code || calcErr.Pos != tt.pos {
+				t.Errorf("%s(%q) error = %#v, expected %v at %d", p.name, tt.expr, err, tt.code, tt.pos)
+			}
+		}
+	}
+}
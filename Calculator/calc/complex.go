@@ -0,0 +1,225 @@
+package calc
+
+import (
+	"math"
+	"math/cmplx"
+	"strconv"
+)
+
+// maxIntegerPower — наибольший целый показатель, который возводится умножением.
+// Так (1+i)^2 даёт ровно 2i, а не 2i с шумом в вещественной части, как у cmplx.Pow.
+const maxIntegerPower = 64
+
+// evaluatePostfixComplex вычисляет постфиксную запись в комплексных числах complex128:
+// sqrt(-4) даёт 2i, а не NaN. Мнимая единица записывается как i, мнимые константы — как 4i или 0.5i.
+// Имя i означает мнимую единицу, только пока в окружении нет переменной i.
+func evaluatePostfixComplex(postfix []Token, env *Env) (complex128, error) {
+	return runPostfix[complex128](postfix, env, complexArithmetic{})
+}
+
+// complexArithmetic — вычисление в complex128.
+type complexArithmetic struct{}
+
+func (complexArithmetic) number(tok Token) (complex128, error) {
+	if tok.Kind == TokenUnit {
+		return 0, realOnly(tok)
+	}
+	if err := inRange(tok); err != nil {
+		return 0, err
+	}
+	if tok.Kind == TokenImag {
+		return complex(0, tok.Value), nil
+	}
+	return complex(tok.Value, 0), nil
+}
+
+func (complexArithmetic) variable(tok Token, env *Env) (complex128, error) {
+	if z, ok := env.getComplex(tok.Text); ok {
+		return z, nil
+	}
+	if _, ok := env.Get(tok.Text); !ok && tok.Text == "i" {
+		return 1i, nil
+	}
+	value, err := lookupVariable(tok, env, tok.Text)
+	if err != nil {
+		return 0, err
+	}
+	return complex(value, 0), nil
+}
+
+// prefix меняет знак вычитанием из нуля: у -4 мнимая часть должна быть +0, а не -0,
+// иначе sqrt(-4) и ln(-1) окажутся на другом берегу разреза и дадут -2i и -πi.
+func (complexArithmetic) prefix(tok Token, _ *Operator, x complex128) (complex128, error) {
+	if tok.Text != unaryMinus {
+		return 0, unsupportedOperator(tok)
+	}
+	return 0 - x, nil
+}
+
+func (complexArithmetic) binary(tok Token, op *Operator, left, right complex128) (complex128, error) {
+	switch tok.Text {
+	case "+":
+		return left + right, nil
+	case "-":
+		return left - right, nil
+	case "*":
+		return left * right, nil
+	case "/":
+		if right == 0 {
+			return 0, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+		}
+		return left / right, nil
+	case "^", "**":
+		return complexPow(tok, left, right)
+	case "==":
+		return complexArithmetic{}.boolean(left == right), nil
+	case "!=":
+		return complexArithmetic{}.boolean(left != right), nil
+	}
+	if isComparison(tok.Text) || tok.Text == "%" || tok.Text == "//" {
+		// Упорядочены и делятся с остатком только вещественные числа
+		if imag(left) != 0 || imag(right) != 0 {
+			return 0, errorAt(ErrDomain, tok, "оператор %s определён только для вещественных чисел", tok.Text)
+		}
+		result, err := applyOperator(tok, op, real(left), real(right))
+		return complex(result, 0), err
+	}
+	return 0, unsupportedOperator(tok)
+}
+
+func (complexArithmetic) truth(x complex128) bool {
+	return x != 0
+}
+
+func (complexArithmetic) boolean(b bool) complex128 {
+	return complex(boolToFloat(b), 0)
+}
+
+// complexPow возводит в степень: небольшой целый показатель — умножением, остальные — через cmplx.Pow.
+func complexPow(tok Token, base, exp complex128) (complex128, error) {
+	n := real(exp)
+	if imag(exp) != 0 || n != math.Trunc(n) || math.Abs(n) > maxIntegerPower {
+		return cmplx.Pow(base, exp), nil
+	}
+	if n < 0 && base == 0 {
+		return 0, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+	}
+
+	result := complex(1, 0)
+	for k := int(math.Abs(n)); k > 0; k-- {
+		result *= base
+	}
+	if n < 0 {
+		result = 1 / result
+	}
+	return result, nil
+}
+
+func (complexArithmetic) call(tok Token, args []complex128) (complex128, error) {
+	if err := checkCall(tok, tok.Text, len(args)); err != nil {
+		return 0, err
+	}
+
+	z := args[0]
+	switch tok.Text {
+	case "abs":
+		return complex(cmplx.Abs(z), 0), nil
+	case "arg":
+		return complex(cmplx.Phase(z), 0), nil
+	case "conj":
+		return cmplx.Conj(z), nil
+	case "re":
+		return complex(real(z), 0), nil
+	case "im":
+		return complex(imag(z), 0), nil
+	case "sqrt":
+		return cmplx.Sqrt(z), nil
+	case "exp":
+		return cmplx.Exp(z), nil
+	case "sin":
+		return cmplx.Sin(z), nil
+	case "cos":
+		return cmplx.Cos(z), nil
+	case "tan":
+		return cmplx.Tan(z), nil
+	case "sum", "avg":
+		var result complex128
+		for _, a := range args {
+			result += a
+		}
+		if tok.Text == "avg" {
+			result /= complex(float64(len(args)), 0)
+		}
+		return result, nil
+	case "prod":
+		result := complex(1, 0)
+		for _, a := range args {
+			result *= a
+		}
+		return result, nil
+	case "ln", "log":
+		if args[len(args)-1] == 0 {
+			return 0, errorAt(ErrDomain, tok, "логарифм нуля не определён")
+		}
+		if len(args) == 2 {
+			if z == 0 || z == 1 {
+				return 0, errorAt(ErrDomain, tok, "недопустимое основание логарифма: %s", formatComplex(z, -1))
+			}
+			return cmplx.Log(args[1]) / cmplx.Log(z), nil
+		}
+		if tok.Text == "log" {
+			return cmplx.Log10(z), nil
+		}
+		return cmplx.Log(z), nil
+	}
+
+	// min, max, median и остальная статистика имеют смысл только для вещественных аргументов
+	values := make([]float64, len(args))
+	for i, a := range args {
+		if imag(a) != 0 {
+			return 0, errorAt(ErrDomain, tok, "функция %s определена только для вещественных чисел", tok.Text)
+		}
+		values[i] = real(a)
+	}
+	result, err := callFunction(tok, tok.Text, values)
+	return complex(result, 0), err
+}
+
+// formatComplex печатает комплексное число в виде "3+4i", "2i" или "-1.5"; digits как у session.formatNumber.
+func formatComplex(z complex128, digits int) string {
+	format := func(x float64) string {
+		if digits >= 0 {
+			return strconv.FormatFloat(x, 'f', digits, 64)
+		}
+		return formatNumber(x)
+	}
+
+	re, im := real(z), imag(z)
+	switch {
+	case im == 0:
+		return format(re)
+	case re == 0:
+		return format(im) + "i"
+	case im < 0:
+		return format(re) + format(im) + "i"
+	}
+	return format(re) + "+" + format(im) + "i"
+}
+
+// evaluateComplex вычисляет строку в комплексных числах; присвоенное значение сохраняется в env вместе с мнимой частью.
+func evaluateComplex(line string, env *Env) (complex128, error) {
+
+	name, postfix, err := parseStatement(line, env)
+	if err != nil {
+		return 0, err
+	}
+	result, err := evaluatePostfixComplex(postfix, env)
+	if err != nil {
+		return 0, err
+	}
+
+	if name != "" {
+		env.setComplex(name, result)
+	}
+	return result, nil
+}
@@ -0,0 +1,175 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"math/cmplx"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateComplex(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"sqrt(-4)", "2i"},
+		{"3+4i", "3+4i"},
+		{"(1+2i)*(3-i)", "5+5i"},
+		{"(1+i)^2", "2i"},
+		{"i^2", "-1"},
+		{"1/i", "-1i"},
+		{"(3+4i)/(1-2i)", "-1+2i"},
+		{"abs(3+4i)", "5"},
+		{"conj(3+4i)", "3-4i"},
+		{"re(3+4i)", "3"},
+		{"im(3+4i)", "4"},
+		{"arg(-1)", "3.14159265358979"},
+		{"-2.5i", "-2.5i"},
+		{"max(1, 2)", "2"},
+		{"sum(1 + i, 2 - 3i)", "3-2i"},
+		{"avg([2i, 4])", "2+1i"},
+		{"prod([i, i])", "-1"},
+		{"(1+i)^2 == 2i", "1"},
+		{"i != 1 && 2 > 1", "1"},
+		{"re(3+4i) < 4 ? 3+4i : 0", "3+4i"},
+		{"-7 % 2 + 7 // 2 * i", "1+3i"},
+		{"(3+4i) * 50%", "1.5+2i"},
+	}
+
+	for _, tt := range tests {
+		result, err := evaluateComplex(tt.expr, nil)
+		if err != nil {
+			t.Errorf("evaluateComplex(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := formatComplex(result, -1); got != tt.expected {
+			t.Errorf("evaluateComplex(%q) = %s, expected %s", tt.expr, got, tt.expected)
+		}
+	}
+}
+
+func TestEvaluateComplexFunctions(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected complex128
+	}{
+		{"exp(i*pi)", -1},
+		{"ln(-1)", complex(0, math.Pi)},
+		{"2^i", cmplx.Pow(2, 1i)},
+		{"arg(1+i)", complex(math.Pi/4, 0)},
+		{"sin(i)", complex(0, math.Sinh(1))},
+	}
+
+	for _, tt := range tests {
+		result, err := evaluateComplex(tt.expr, NewEnv())
+		if err != nil {
+			t.Errorf("evaluateComplex(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if cmplx.Abs(result-tt.expected) > 1e-12 {
+			t.Errorf("evaluateComplex(%q) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+}
+
+func TestEvaluateComplexErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+	}{
+		{"1 / (i - i)", ErrDivisionByZero},
+		{"0^-1", ErrDivisionByZero},
+		{"ln(0)", ErrDomain},
+		{"log(1, 5)", ErrDomain},
+		{"max(1, i)", ErrDomain},
+		{"median(1, i)", ErrDomain},
+		{"1e400i", ErrMalformedNumber},
+		{"abs()", ErrArity},
+		{"j + 1", ErrUndefinedVariable},
+		{"i < 2", ErrDomain},
+	}
+
+	for _, tt := range tests {
+		_, err := evaluateComplex(tt.expr, nil)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code {
+			t.Errorf("evaluateComplex(%q) error = %v, expected code %d", tt.expr, err, tt.code)
+		}
+	}
+}
+
+func TestComplexVariables(t *testing.T) {
+	env := NewEnv()
+	if _, err := evaluateComplex("z = 1 + 2i", env); err != nil {
+		t.Fatalf("evaluateComplex unexpected error: %v", err)
+	}
+
+	result, err := evaluateComplex("z * conj(z)", env)
+	if err != nil || result != 5 {
+		t.Errorf("z * conj(z) = %v, %v, expected 5", result, err)
+	}
+
+	// Вне режима complex комплексная переменная и мнимые константы — ошибка области определения
+	for _, expr := range []string{"z + 1", "2i", "i"} {
+		_, err := evaluate(expr, env)
+		var calcErr *CalcError
+		if expr == "i" {
+			if !errors.As(err, &calcErr) || calcErr.Code != ErrUndefinedVariable {
+				t.Errorf("evaluate(%q) error = %v, expected undefined variable", expr, err)
+			}
+			continue
+		}
+		if !errors.As(err, &calcErr) || calcErr.Code != ErrDomain {
+			t.Errorf("evaluate(%q) error = %v, expected domain error", expr, err)
+		}
+	}
+
+	// Вещественный результат сохраняется как обычная переменная
+	if _, err := evaluateComplex("w = (1+i)*(1-i)", env); err != nil {
+		t.Fatalf("evaluateComplex unexpected error: %v", err)
+	}
+	if value, err := evaluate("w + 1", env); err != nil || value != 3 {
+		t.Errorf("w + 1 = %v, %v, expected 3", value, err)
+	}
+
+	// Своя переменная i заслоняет мнимую единицу
+	env.Set("i", 10)
+	if result, err := evaluateComplex("2*i", env); err != nil || result != 20 {
+		t.Errorf("2*i with i = 10 gives %v, %v, expected 20", result, err)
+	}
+}
+
+func TestREPLComplexMode(t *testing.T) {
+	input := strings.Join([]string{
+		":mode complex",
+		"sqrt(-4)",
+		"z = 3 - 4i",
+		"abs(z)",
+		":digits 2",
+		"z / 2",
+		":vars",
+		":tree 3 + 4i*2",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, &Env{}); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> Режим: complex\n",
+		"> 2i\n",
+		"> 3-4i\n",
+		"> 5\n",
+		"> 1.50-2.00i\n",
+		"> ans = 1.50-2.00i\nz = 3.00-4.00i\n",
+		"> Дерево: 3 + 4i * 2\n",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+}
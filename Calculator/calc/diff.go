@@ -0,0 +1,300 @@
+package calc
+
+import (
+	"math"
+)
+
+// Derivative строит производную дерева n по переменной x.
+// Результат — новое дерево; исходное не меняется. Узлы результата собираются через конструкторы ниже,
+// которые сразу убирают нули и единицы, поэтому (x^3)' печатается как 3 * x^2, а не 3 * x^(3 - 1) * 1.
+// Остальные переменные считаются константами. Для min, max и других функций без гладкой производной
+// возвращается ошибка ErrDomain.
+func Derivative(n Node, x string) (Node, error) {
+
+	switch n := n.(type) {
+	case *NumberNode:
+		return num(0), nil
+
+	case *VarNode:
+		if n.Name == x {
+			return num(1), nil
+		}
+		return num(0), nil
+
+	case *UnaryNode:
+		if n.Op == logicalNot {
+			return num(0), nil
+		}
+		dx, err := Derivative(n.X, x)
+		if err != nil {
+			return nil, err
+		}
+		return neg(dx), nil
+
+	case *BinaryNode:
+		return binaryDerivative(n, x)
+
+	case *CondNode:
+		// Производная берётся в каждой ветке, условие остаётся прежним; в точке переключения её нет
+		then, err := Derivative(n.Then, x)
+		if err != nil {
+			return nil, err
+		}
+		otherwise, err := Derivative(n.Else, x)
+		if err != nil {
+			return nil, err
+		}
+		return &CondNode{Cond: n.Cond, Then: then, Else: otherwise}, nil
+
+	case *CallNode:
+		return callDerivative(n, x)
+	}
+
+	return nil, &CalcError{Code: ErrEvaluation, Pos: -1, Msg: "ошибка вычисления выражения"}
+}
+
+func binaryDerivative(n *BinaryNode, x string) (Node, error) {
+
+	// Сравнения, логические операторы и частное вниз кусочно-постоянны
+	if isComparison(n.Op) || n.Op == "&&" || n.Op == "||" || n.Op == "//" {
+		return num(0), nil
+	}
+
+	u, v := n.Left, n.Right
+	du, err := Derivative(u, x)
+	if err != nil {
+		return nil, err
+	}
+	dv, err := Derivative(v, x)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case "+":
+		return add(du, dv), nil
+	case "-":
+		return sub(du, dv), nil
+	case "*":
+		// (uv)' = u'v + uv'
+		return add(mul(du, v), mul(u, dv)), nil
+	case "/":
+		// (u/v)' = (u'v - uv') / v^2
+		return div(sub(mul(du, v), mul(u, dv)), pow(v, num(2))), nil
+	case "%":
+		// u % v = u - (u // v) * v, а (u // v)' = 0
+		return sub(du, mul(&BinaryNode{Op: "//", Left: u, Right: v}, dv)), nil
+	case "^":
+		switch {
+		case !dependsOn(v, x):
+			// (u^c)' = c * u^(c - 1) * u'
+			return mul(mul(v, pow(u, sub(v, num(1)))), du), nil
+		case !dependsOn(u, x):
+			// (c^v)' = c^v * ln(c) * v'
+			return mul(mul(n, call("ln", u)), dv), nil
+		}
+		// (u^v)' = u^v * (v' * ln(u) + v * u' / u)
+		return mul(n, add(mul(dv, call("ln", u)), div(mul(v, du), u))), nil
+	}
+	return nil, errorAt(ErrUnknownToken, n, "неизвестный токен: %s", n.Op)
+}
+
+func callDerivative(n *CallNode, x string) (Node, error) {
+
+	if n.Name == "log" && len(n.Args) == 2 {
+		base, u := n.Args[0], n.Args[1]
+		if dependsOn(base, x) {
+			// log(b, u) = ln(u) / ln(b)
+			return Derivative(div(call("ln", u), call("ln", base)), x)
+		}
+		// log(b, u)' = u' / (u * ln(b)) при постоянном основании
+		du, err := Derivative(u, x)
+		if err != nil {
+			return nil, err
+		}
+		return div(du, mul(u, call("ln", base))), nil
+	}
+	if n.Name == "sum" || n.Name == "avg" {
+		// Производная суммы — сумма производных, среднего — их среднее
+		var d Node
+		for i, arg := range n.Args {
+			da, err := Derivative(arg, x)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 {
+				d = da
+			} else {
+				d = add(d, da)
+			}
+		}
+		if n.Name == "avg" {
+			d = div(d, num(float64(len(n.Args))))
+		}
+		return d, nil
+	}
+	if len(n.Args) != 1 {
+		return nil, errorAt(ErrDomain, n, "функция %s не дифференцируется", n.Name)
+	}
+
+	u := n.Args[0]
+	du, err := Derivative(u, x)
+	if err != nil {
+		return nil, err
+	}
+
+	// Производная внешней функции, умножаемая затем на u'
+	var outer Node
+	switch n.Name {
+	case "sqrt":
+		return div(du, mul(num(2), n)), nil
+	case "sin":
+		outer = call("cos", u)
+	case "cos":
+		outer = neg(call("sin", u))
+	case "tan":
+		return div(du, pow(call("cos", u), num(2))), nil
+	case "exp":
+		outer = n
+	case "ln":
+		return div(du, u), nil
+	case "log":
+		return div(du, mul(u, call("ln", num(10)))), nil
+	case "abs":
+		// |u|' = u' * u / |u|, в нуле не определена
+		return div(mul(du, u), n), nil
+	default:
+		return nil, errorAt(ErrDomain, n, "функция %s не дифференцируется", n.Name)
+	}
+	return mul(outer, du), nil
+}
+
+// dependsOn сообщает, входит ли переменная x в дерево n.
+func dependsOn(n Node, x string) bool {
+	switch n := n.(type) {
+	case *VarNode:
+		return n.Name == x
+	case *UnaryNode:
+		return dependsOn(n.X, x)
+	case *BinaryNode:
+		return dependsOn(n.Left, x) || dependsOn(n.Right, x)
+	case *CondNode:
+		return dependsOn(n.Cond, x) || dependsOn(n.Then, x) || dependsOn(n.Else, x)
+	case *CallNode:
+		for _, arg := range n.Args {
+			if dependsOn(arg, x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Конструкторы узлов с простейшими упрощениями: числа складываются и умножаются сразу,
+// x + 0, x * 1, x^1 и x^0 заменяются результатом. Деление чисел не выполняется, чтобы не терять точность: 1/3 остаётся 1/3.
+
+func num(v float64) Node {
+	return &NumberNode{Value: v}
+}
+
+// isNumber сообщает, является ли n числовой константой со значением v.
+func isNumber(n Node, v float64) bool {
+	number, ok := n.(*NumberNode)
+	return ok && !number.Imag && number.Value == v
+}
+
+// numbers возвращает значения a и b, если оба узла — вещественные числа.
+func numbers(a, b Node) (float64, float64, bool) {
+	x, ok1 := a.(*NumberNode)
+	y, ok2 := b.(*NumberNode)
+	if !ok1 || !ok2 || x.Imag || y.Imag {
+		return 0, 0, false
+	}
+	return x.Value, y.Value, true
+}
+
+func neg(a Node) Node {
+	switch a := a.(type) {
+	case *NumberNode:
+		if !a.Imag {
+			return num(0 - a.Value) // вычитание из нуля не даёт -0
+		}
+	case *UnaryNode:
+		if a.Op == "-" {
+			return a.X
+		}
+	}
+	return &UnaryNode{Op: "-", X: a}
+}
+
+func add(a, b Node) Node {
+	if x, y, ok := numbers(a, b); ok {
+		return num(x + y)
+	}
+	switch {
+	case isNumber(a, 0):
+		return b
+	case isNumber(b, 0):
+		return a
+	}
+	return &BinaryNode{Op: "+", Left: a, Right: b}
+}
+
+func sub(a, b Node) Node {
+	if x, y, ok := numbers(a, b); ok {
+		return num(x - y)
+	}
+	switch {
+	case isNumber(b, 0):
+		return a
+	case isNumber(a, 0):
+		return neg(b)
+	}
+	return &BinaryNode{Op: "-", Left: a, Right: b}
+}
+
+func mul(a, b Node) Node {
+	if x, y, ok := numbers(a, b); ok {
+		return num(x * y)
+	}
+	switch {
+	case isNumber(a, 0) || isNumber(b, 0):
+		return num(0)
+	case isNumber(a, 1):
+		return b
+	case isNumber(b, 1):
+		return a
+	case isNumber(a, -1):
+		return neg(b)
+	case isNumber(b, -1):
+		return neg(a)
+	}
+	return &BinaryNode{Op: "*", Left: a, Right: b}
+}
+
+func div(a, b Node) Node {
+	switch {
+	case isNumber(b, 1):
+		return a
+	case isNumber(a, 0) && !isNumber(b, 0):
+		return num(0)
+	}
+	return &BinaryNode{Op: "/", Left: a, Right: b}
+}
+
+func pow(a, b Node) Node {
+	if x, y, ok := numbers(a, b); ok && y == math.Trunc(y) && y >= 0 && y <= 64 {
+		return num(math.Pow(x, y))
+	}
+	switch {
+	case isNumber(b, 0):
+		return num(1)
+	case isNumber(b, 1):
+		return a
+	}
+	return &BinaryNode{Op: "^", Left: a, Right: b}
+}
+
+func call(name string, args ...Node) Node {
+	return &CallNode{Name: name, Args: args}
+}
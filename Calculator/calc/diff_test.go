@@ -0,0 +1,144 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestDerivative(t *testing.T) {
+	tests := []struct {
+		expr     string
+		x        string
+		expected string
+	}{
+		{"42", "x", "0"},
+		{"x", "x", "1"},
+		{"y", "x", "0"},
+		{"3*x + 2", "x", "3"},
+		{"x^3", "x", "3 * x^2"},
+		{"x^n", "x", "n * x^(n - 1)"},
+		{"2^x", "x", "2^x * ln(2)"},
+		{"-x^2", "x", "-(2 * x)"},
+		{"x * y", "y", "x"},
+		{"x * sin(x)", "x", "sin(x) + x * cos(x)"},
+		{"1 / x", "x", "-1 / x^2"},
+		{"sin(2*x)", "x", "cos(2 * x) * 2"},
+		{"cos(x)", "x", "-sin(x)"},
+		{"exp(x^2)", "x", "exp(x^2) * (2 * x)"},
+		{"ln(x)", "x", "1 / x"},
+		{"log(2, x)", "x", "1 / (x * ln(2))"},
+		{"log(b, x^2)", "x", "2 * x / (x^2 * ln(b))"},
+		{"log(x, 8)", "x", "-(ln(8) * (1 / x)) / ln(x)^2"},
+		{"sqrt(x)", "x", "1 / (2 * sqrt(x))"},
+		{"x^x", "x", "x^x * (ln(x) + x / x)"},
+		{"a*x^2 + b*x + c", "x", "a * (2 * x) + b"},
+		{"x > 0 ? x^2 : -x", "x", "x > 0 ? 2 * x : -1"},
+		{"(x < 1) + !x", "x", "0"},
+		{"-!x", "x", "0"},
+		{"x^2 // 3", "x", "0"},
+		{"x % y", "y", "-(x // y)"},
+		{"2*x mod 3", "x", "2"},
+		{"sum(x, x^2, y)", "x", "1 + 2 * x"},
+		{"avg([x, y])", "x", "1 / 2"},
+	}
+
+	for _, tt := range tests {
+		tree, err := ParseTree(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseTree(%q) unexpected error: %v", tt.expr, err)
+		}
+		d, err := Derivative(tree, tt.x)
+		if err != nil {
+			t.Errorf("Derivative(%q, %s) unexpected error: %v", tt.expr, tt.x, err)
+			continue
+		}
+		if got := Format(d); got != tt.expected {
+			t.Errorf("Derivative(%q, %s) = %s, expected %s", tt.expr, tt.x, got, tt.expected)
+		}
+	}
+}
+
+// Производная должна совпадать с разностной в нескольких точках
+func TestDerivativeNumerically(t *testing.T) {
+	exprs := []string{
+		"x^3 - 2*x",
+		"sin(x) * cos(x)",
+		"tan(x) / x",
+		"exp(-x^2 / 2)",
+		"log(x) + log(2, x)",
+		"sqrt(x^2 + 1)",
+		"abs(x - 3)",
+		"x^x",
+		"(x + 1)^(1/3)",
+		"pi^x",
+	}
+	const h = 1e-6
+
+	for _, expr := range exprs {
+		tree, err := ParseTree(expr)
+		if err != nil {
+			t.Fatalf("ParseTree(%q) unexpected error: %v", expr, err)
+		}
+		d, err := Derivative(tree, "x")
+		if err != nil {
+			t.Errorf("Derivative(%q) unexpected error: %v", expr, err)
+			continue
+		}
+		for _, x := range []float64{0.5, 1.3, 2.2} {
+			at := func(n Node, v float64) float64 {
+				env := NewEnv()
+				env.Set("x", v)
+				value, err := evalTree(n, env)
+				if err != nil {
+					t.Fatalf("evalTree(%s) at x = %v unexpected error: %v", Format(n), v, err)
+				}
+				return value
+			}
+			want := (at(tree, x+h) - at(tree, x-h)) / (2 * h)
+			if got := at(d, x); math.Abs(got-want) > 1e-5*math.Max(1, math.Abs(want)) {
+				t.Errorf("(%s)' at x = %v: %s = %v, expected %v", expr, x, Format(d), got, want)
+			}
+		}
+	}
+}
+
+func TestDerivativeErrors(t *testing.T) {
+	for _, expr := range []string{"max(x, 1)", "2 * min(x, y, 3)"} {
+		tree, err := ParseTree(expr)
+		if err != nil {
+			t.Fatalf("ParseTree(%q) unexpected error: %v", expr, err)
+		}
+		_, err = Derivative(tree, "x")
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != ErrDomain || calcErr.Pos < 0 {
+			t.Errorf("Derivative(%q) error = %v, expected positioned domain error", expr, err)
+		}
+	}
+}
+
+func TestREPLDiff(t *testing.T) {
+	input := strings.Join([]string{
+		":diff x^2 + y*x",
+		":diff x*y^2, y",
+		":diff max(x, y)",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, NewEnv()); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> Производная: 2 * x + y\n",
+		"> Производная: 2 * x * y\n",
+		"Ошибка: функция max не дифференцируется",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+}
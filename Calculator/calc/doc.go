@@ -0,0 +1,23 @@
+// Package calc — калькулятор выражений: разбор, вычисление в нескольких числовых системах,
+// производные и упрощение, а также REPL и HTTP-сервер поверх них.
+//
+// Вычислить выражение:
+//
+//	r, err := calc.Evaluate("2 * (3 + 4)", nil)                              // r.Value == 14
+//	r, err := calc.Evaluate("1/3 + 1/6", &calc.Options{Mode: calc.ModeRat}) // r.Text == "1/2"
+//
+// Разобрать один раз и вычислять при разных значениях переменных:
+//
+//	e, err := calc.Parse("price + 15%", nil)
+//	r, err := e.Eval(map[string]float64{"price": 200}) // r.Value == 230
+//
+// Дерево выражения строит ParseTree; его можно продифференцировать, упростить и напечатать:
+//
+//	tree, err := calc.ParseTree("x^3 + 2*x")
+//	d, err := calc.Derivative(tree, "x")
+//	d, _ = calc.Simplify(d)
+//	fmt.Println(calc.Format(d)) // 3 * x^2 + 2
+//
+// Для вычисления в плотном цикле без выделения памяти есть Compile и Program, для встраивания в свою программу
+// — RunREPL и NewServer. Все ошибки разбора и вычисления — *CalcError с кодом ErrorCode и местом в выражении.
+package calc
@@ -0,0 +1,266 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+)
+
+// Env — окружение вычислений: значения именованных переменных.
+// Вычислитель ищет в нём все имена, которые не являются вызовами функций.
+// Нулевой указатель допустим и означает пустое окружение.
+//
+// У каждой переменной есть значение float64. Если её присвоили в другом режиме (дроби, произвольная точность,
+// комплексные числа, величины с единицами), рядом хранится и исходное значение, чтобы тот же режим видел его без потерь.
+//
+// Кроме переменных, в окружении хранятся функции пользователя вида f(x, y) = x^2 + y
+// и набор операторов, если он отличается от встроенного.
+type Env struct {
+	vars  map[string]float64
+	typed map[string]any // *big.Rat, *big.Float, complex128 или quantity
+	funcs map[string]*userFunction
+	ops   *OperatorSet
+}
+
+// NewEnv создаёт окружение с предопределёнными константами pi и e.
+func NewEnv() *Env {
+	return &Env{vars: map[string]float64{
+		"pi": math.Pi,
+		"e":  math.E,
+	}}
+}
+
+// Get возвращает значение переменной и признак того, что она определена.
+func (env *Env) Get(name string) (float64, bool) {
+	if env == nil {
+		return 0, false
+	}
+	value, ok := env.vars[name]
+	return value, ok
+}
+
+// Set задаёт значение переменной, при необходимости создавая её.
+func (env *Env) Set(name string, value float64) {
+	if env.vars == nil {
+		env.vars = make(map[string]float64)
+	}
+	env.vars[name] = value
+	delete(env.typed, name)
+}
+
+// setTyped задаёт значение переменной вместе с его приближением float64.
+func (env *Env) setTyped(name string, approx float64, value any) {
+	env.Set(name, approx)
+	if env.typed == nil {
+		env.typed = make(map[string]any)
+	}
+	env.typed[name] = value
+}
+
+// setRat задаёт точное значение переменной. В обычном режиме она будет видна как ближайшее float64.
+func (env *Env) setRat(name string, value *big.Rat) {
+	f, _ := value.Float64()
+	env.setTyped(name, f, new(big.Rat).Set(value))
+}
+
+// getRat возвращает точное значение переменной, если она была присвоена в режиме дробей.
+func (env *Env) getRat(name string) (*big.Rat, bool) {
+	if env == nil {
+		return nil, false
+	}
+	value, ok := env.typed[name].(*big.Rat)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Rat).Set(value), true
+}
+
+// setBig задаёт значение переменной произвольной точности. В обычном режиме она будет видна как ближайшее float64.
+func (env *Env) setBig(name string, value *big.Float) {
+	f, _ := value.Float64()
+	env.setTyped(name, f, new(big.Float).Copy(value))
+}
+
+// getBig возвращает значение переменной, если она была присвоена в режиме произвольной точности.
+func (env *Env) getBig(name string) (*big.Float, bool) {
+	if env == nil {
+		return nil, false
+	}
+	value, ok := env.typed[name].(*big.Float)
+	if !ok {
+		return nil, false
+	}
+	return new(big.Float).Copy(value), true
+}
+
+// setComplex задаёт комплексное значение переменной. Вещественное число сохраняется как обычное,
+// а переменная с ненулевой мнимой частью вне режима complex даёт ошибку при обращении.
+func (env *Env) setComplex(name string, value complex128) {
+	if imag(value) == 0 {
+		env.Set(name, real(value))
+		return
+	}
+	env.setTyped(name, math.NaN(), value)
+}
+
+// getComplex возвращает значение переменной с ненулевой мнимой частью.
+func (env *Env) getComplex(name string) (complex128, bool) {
+	if env == nil {
+		return 0, false
+	}
+	value, ok := env.typed[name].(complex128)
+	return value, ok
+}
+
+// setQuantity задаёт величину с единицами измерения. Безразмерное число без единицы сохраняется как обычное,
+// а величина с размерностью вне режима units даёт ошибку при обращении.
+func (env *Env) setQuantity(name string, value quantity) {
+	if value.dim.isZero() && len(value.unit) == 0 {
+		env.Set(name, value.value)
+		return
+	}
+	env.setTyped(name, value.value, value)
+}
+
+// getQuantity возвращает значение переменной, если она была присвоена в режиме units.
+func (env *Env) getQuantity(name string) (quantity, bool) {
+	if env == nil {
+		return quantity{}, false
+	}
+	value, ok := env.typed[name].(quantity)
+	return value, ok
+}
+
+// Names возвращает имена всех переменных в алфавитном порядке.
+func (env *Env) Names() []string {
+	if env == nil {
+		return nil
+	}
+	names := make([]string, 0, len(env.vars))
+	for name := range env.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// defineFunction сохраняет функцию пользователя, заменяя прежнее определение с тем же именем.
+func (env *Env) defineFunction(fn *userFunction) {
+	if env.funcs == nil {
+		env.funcs = make(map[string]*userFunction)
+	}
+	env.funcs[fn.Name] = fn
+}
+
+// userFunction возвращает функцию пользователя по имени.
+func (env *Env) userFunction(name string) (*userFunction, bool) {
+	if env == nil {
+		return nil, false
+	}
+	fn, ok := env.funcs[name]
+	return fn, ok
+}
+
+// FunctionNames возвращает имена функций пользователя в алфавитном порядке.
+func (env *Env) FunctionNames() []string {
+	if env == nil {
+		return nil
+	}
+	names := make([]string, 0, len(env.funcs))
+	for name := range env.funcs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// resolve находит встроенную функцию или функцию пользователя для разбора выражения.
+func (env *Env) resolve(name string) (function, bool) {
+	if f, ok := functions[name]; ok {
+		return f, true
+	}
+	if fn, ok := env.userFunction(name); ok {
+		return fn.signature(), true
+	}
+	return function{}, false
+}
+
+// SetOperators задаёт набор операторов, которым разбираются и вычисляются выражения в этом окружении.
+// Набор не копируется: операторы, зарегистрированные в нём позже, тоже станут видны.
+func (env *Env) SetOperators(ops *OperatorSet) {
+	env.ops = ops
+}
+
+// operators возвращает набор операторов окружения; без своего набора — встроенный.
+func (env *Env) operators() *OperatorSet {
+	if env == nil || env.ops == nil {
+		return builtinOperators
+	}
+	return env.ops
+}
+
+// UndefinedVariableError — ошибка обращения к переменной, которой нет в окружении.
+type UndefinedVariableError struct {
+	Name string
+}
+
+func (e *UndefinedVariableError) Error() string {
+	return fmt.Sprintf("неизвестная переменная: %s", e.Name)
+}
+
+// parseStatement разбирает строку — выражение или присваивание вида "x = 3.5".
+// В выражении можно вызывать функции пользователя из env; определения функций разбирает define.
+// Для присваивания возвращает имя переменной и постфиксную запись правой части, для выражения имя пустое.
+func parseStatement(line string, env *Env) (string, []Token, error) {
+
+	tokens, err := tokenizeWith(line, env.operators())
+	if err != nil {
+		return "", nil, err
+	}
+	return parseTokens(tokens, env)
+}
+
+// parseTokens — parseStatement для строки, уже разобранной на токены.
+func parseTokens(tokens []Token, env *Env) (string, []Token, error) {
+
+	name := ""
+	if len(tokens) >= 2 && tokens[0].Kind == TokenIdent && tokens[1].Kind == TokenAssign {
+		name = tokens[0].Text
+		if _, ok := functions[name]; ok {
+			return "", nil, errorAt(ErrAssignment, tokens[0], "имя %s занято встроенной функцией", name)
+		}
+		if env == nil {
+			return "", nil, errorAt(ErrAssignment, tokens[1], "присваивание невозможно без окружения")
+		}
+		if len(tokens) == 2 {
+			return "", nil, errorAt(ErrAssignment, tokens[1], "пропущено значение переменной %s", name)
+		}
+		tokens = tokens[2:]
+	}
+
+	postfix, err := infixToPostfixWith(tokens, env.resolve, env.operators())
+	if err != nil {
+		return "", nil, err
+	}
+	return name, postfix, nil
+}
+
+// evaluate вычисляет одну строку: выражение или присваивание вида "x = 3.5".
+// При присваивании значение сохраняется в env и возвращается как результат.
+func evaluate(line string, env *Env) (float64, error) {
+
+	name, postfix, err := parseStatement(line, env)
+	if err != nil {
+		return 0, err
+	}
+	result, err := evaluatePostfix(postfix, env)
+	if err != nil {
+		return 0, err
+	}
+
+	if name != "" {
+		env.Set(name, result)
+	}
+	return result, nil
+}
@@ -0,0 +1,102 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestEvaluateStatements(t *testing.T) {
+	env := NewEnv()
+	steps := []struct {
+		line     string
+		expected float64
+	}{
+		{"x = 3.5", 3.5},
+		{"2*x + 1", 8},
+		{"y = x * 2", 7},
+		{"x = y - 1", 6},
+		{"x + y", 13},
+		{"-x^2", -36},
+		{"max(x, y, 10)", 10},
+		{"r = 2", 2},
+		{"pi * r^2", math.Pi * 4},
+	}
+
+	for _, step := range steps {
+		result, err := evaluate(step.line, env)
+		if err != nil {
+			t.Fatalf("evaluate(%q) unexpected error: %v", step.line, err)
+		}
+		if math.Abs(result-step.expected) > 1e-9 {
+			t.Errorf("evaluate(%q) = %v, expected %v", step.line, result, step.expected)
+		}
+	}
+
+	expected := []string{"e", "pi", "r", "x", "y"}
+	if names := env.Names(); !reflect.DeepEqual(names, expected) {
+		t.Errorf("env.Names() = %v, expected %v", names, expected)
+	}
+}
+
+func TestEvaluatePostfixWithEnv(t *testing.T) {
+	env := &Env{}
+	env.Set("a", 2)
+	env.Set("b", 5)
+
+	result, err := evaluatePostfix(tokensOf([]string{"a", "b", "*", "1", "+"}), env)
+	if err != nil {
+		t.Fatalf("evaluatePostfix unexpected error: %v", err)
+	}
+	if result != 11 {
+		t.Errorf("evaluatePostfix = %v, expected 11", result)
+	}
+}
+
+func TestUndefinedVariable(t *testing.T) {
+	tests := []struct {
+		line string
+		name string
+	}{
+		{"3 + unknown", "unknown"},
+		{"z = w * 2", "w"},
+		{"sqrt(q)", "q"},
+	}
+
+	for _, tt := range tests {
+		env := NewEnv()
+		_, err := evaluate(tt.line, env)
+		var undefined *UndefinedVariableError
+		if !errors.As(err, &undefined) {
+			t.Errorf("evaluate(%q) error = %v, expected *UndefinedVariableError", tt.line, err)
+			continue
+		}
+		if undefined.Name != tt.name {
+			t.Errorf("evaluate(%q) undefined name = %q, expected %q", tt.line, undefined.Name, tt.name)
+		}
+		if _, ok := env.Get("z"); ok {
+			t.Errorf("evaluate(%q) assigned a variable despite the error", tt.line)
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		env  *Env
+	}{
+		{"x = ", NewEnv()},      // Пустая правая часть
+		{"sqrt = 4", NewEnv()},  // Имя встроенной функции
+		{"x = 1", nil},          // Нет окружения
+		{"x = y = 1", NewEnv()}, // Цепочка присваиваний
+		{"2 = x", NewEnv()},     // Слева не имя
+		{"x + 1 = 2", NewEnv()}, // Слева выражение
+	}
+
+	for _, tt := range tests {
+		if _, err := evaluate(tt.line, tt.env); err == nil {
+			t.Errorf("evaluate(%q) expected error", tt.line)
+		}
+	}
+}
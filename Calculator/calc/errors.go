@@ -0,0 +1,135 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrorCode — вид ошибки разбора или вычисления.
+type ErrorCode int
+
+const (
+	ErrUnknownToken      ErrorCode = iota + 1 // символ, который калькулятор не понимает
+	ErrMalformedNumber                        // число с ошибкой записи: "1.2.3", "."
+	ErrMismatchedParen                        // непарная скобка
+	ErrMissingOperand                         // оператор без операнда: "3 +", "* 2", "()"
+	ErrMissingOperator                        // два операнда подряд: "2 3", "2 (3)"
+	ErrMisplacedComma                         // запятая вне вызова функции
+	ErrUnknownFunction                        // вызов несуществующей функции
+	ErrArity                                  // неверное число аргументов функции
+	ErrUndefinedVariable                      // переменной нет в окружении
+	ErrDivisionByZero                         // деление на ноль
+	ErrDomain                                 // аргумент вне области определения функции
+	ErrAssignment                             // некорректное присваивание
+	ErrEvaluation                             // некорректная постфиксная запись
+	ErrConditional                            // ? без : или : без ? в условном выражении
+	ErrDimension                              // несовместимые размерности: метры плюс секунды
+	ErrLimit                                  // выражение превышает ограничения Limits
+	ErrMisplacedList                          // список [1, 2] не аргументом функции с любым числом аргументов
+)
+
+// errorCodeNames — имена кодов для внешних клиентов, например в ответах HTTP-сервера.
+var errorCodeNames = [...]string{
+	ErrUnknownToken:      "unknown-token",
+	ErrMalformedNumber:   "malformed-number",
+	ErrMismatchedParen:   "mismatched-paren",
+	ErrMissingOperand:    "missing-operand",
+	ErrMissingOperator:   "missing-operator",
+	ErrMisplacedComma:    "misplaced-comma",
+	ErrUnknownFunction:   "unknown-function",
+	ErrArity:             "arity",
+	ErrUndefinedVariable: "undefined-variable",
+	ErrDivisionByZero:    "division-by-zero",
+	ErrDomain:            "domain",
+	ErrAssignment:        "assignment",
+	ErrEvaluation:        "evaluation",
+	ErrConditional:       "conditional",
+	ErrDimension:         "dimension",
+	ErrLimit:             "limit",
+	ErrMisplacedList:     "misplaced-list",
+}
+
+func (c ErrorCode) String() string {
+	if c > 0 && int(c) < len(errorCodeNames) {
+		return errorCodeNames[c]
+	}
+	return fmt.Sprintf("ErrorCode(%d)", int(c))
+}
+
+// CalcError — ошибка с указанием места в исходном выражении.
+// Pos и End — номера символов (рун) начала и конца проблемного фрагмента, End не включается.
+// Pos < 0 означает, что место неизвестно (например, постфиксная запись составлена вручную).
+type CalcError struct {
+	Code ErrorCode
+	Pos  int
+	End  int
+	Msg  string
+	Err  error // исходная ошибка, если есть (например *UndefinedVariableError)
+}
+
+func (e *CalcError) Error() string {
+	if e.Pos < 0 {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s (позиция %d)", e.Msg, e.Pos+1)
+}
+
+func (e *CalcError) Unwrap() error {
+	return e.Err
+}
+
+// Span — место фрагмента в исходной строке: номера символов начала и конца, End не включается.
+// Нулевой Span означает, что фрагмент построен программно и места в строке у него нет.
+type Span struct {
+	Pos int
+	End int
+}
+
+func (s Span) span() Span {
+	return s
+}
+
+// spanner — всё, у чего есть место в исходной строке: токены и узлы дерева.
+type spanner interface {
+	span() Span
+}
+
+// errorAt создаёт ошибку, указывающую на токен или узел at.
+func errorAt(code ErrorCode, at spanner, format string, args ...any) *CalcError {
+	s := at.span()
+	if s.End == 0 {
+		s.Pos = -1
+	}
+	return &CalcError{Code: code, Pos: s.Pos, End: s.End, Msg: fmt.Sprintf(format, args...)}
+}
+
+// formatDiagnostic печатает выражение и подчёркивает место ошибки:
+//
+//	3 + (4 * 2
+//	    ^
+//	Ошибка: не совпадают скобки (позиция 5)
+//
+// Для ошибок без позиции печатается только сообщение.
+func formatDiagnostic(expr string, err error) string {
+
+	var calcErr *CalcError
+	if !errors.As(err, &calcErr) || calcErr.Pos < 0 {
+		return "Ошибка: " + err.Error()
+	}
+
+	width := calcErr.End - calcErr.Pos
+	if width < 1 {
+		width = 1
+	}
+
+	var b strings.Builder
+	b.WriteString(expr)
+	b.WriteByte('\n')
+	b.WriteString(strings.Repeat(" ", calcErr.Pos))
+	b.WriteByte('^')
+	b.WriteString(strings.Repeat("~", width-1))
+	b.WriteByte('\n')
+	b.WriteString("Ошибка: " + err.Error())
+	return b.String()
+}
@@ -0,0 +1,110 @@
+package calc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTokenPositions(t *testing.T) {
+	tokens, err := tokenize("  sqrt(x1)**2 ")
+	if err != nil {
+		t.Fatalf("tokenize unexpected error: %v", err)
+	}
+	expected := []Token{
+		{Kind: TokenIdent, Text: "sqrt", Pos: 2, End: 6},
+		{Kind: TokenLParen, Text: "(", Pos: 6, End: 7},
+		{Kind: TokenIdent, Text: "x1", Pos: 7, End: 9},
+		{Kind: TokenRParen, Text: ")", Pos: 9, End: 10},
+		{Kind: TokenOperator, Text: "**", Pos: 10, End: 12},
+		{Kind: TokenNumber, Text: "2", Value: 2, Pos: 12, End: 13},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("tokenize returned %v, expected %v", tokens, expected)
+	}
+	for i := range expected {
+		if tokens[i] != expected[i] {
+			t.Errorf("token %d = %+v, expected %+v", i, tokens[i], expected[i])
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+		pos  int
+		end  int
+	}{
+		{"3 + (4 * 2", ErrMismatchedParen, 4, 5},
+		{"(1 + 2))", ErrMismatchedParen, 7, 8},
+		{"3 + @", ErrUnknownToken, 4, 5},
+		{"3 +", ErrMissingOperand, 3, 4},
+		{"* 2", ErrMissingOperand, 0, 1},
+		{"2 3", ErrMissingOperator, 2, 3},
+		{"2 (3)", ErrMissingOperator, 2, 3},
+		{"()", ErrMissingOperand, 1, 2},
+		{"1, 2", ErrMisplacedComma, 1, 2},
+		{"max(1, , 2)", ErrMissingOperand, 7, 8},
+		{"[1, 2]", ErrMisplacedList, 0, 1},
+		{"sqrt([4])", ErrMisplacedList, 5, 6},
+		{"sum([1] * 2)", ErrMisplacedList, 8, 9},
+		{"sum([1, 2)", ErrMismatchedParen, 9, 10},
+		{"sum([1, , 2])", ErrMissingOperand, 8, 9},
+		{"sum([])", ErrArity, 0, 3},
+		{"foo(1)", ErrUnknownFunction, 0, 3},
+		{"1 + sqrt(1, 2)", ErrArity, 4, 8},
+		{"10 / (5 - 5)", ErrDivisionByZero, 3, 4},
+		{"2 * 1e400", ErrMalformedNumber, 4, 9},
+		{"2 * unknown", ErrUndefinedVariable, 4, 11},
+		{"log(1, 5)", ErrDomain, 0, 3},
+		{"sqrt = 1", ErrAssignment, 0, 4},
+		{"x =", ErrAssignment, 2, 3},
+	}
+
+	for _, tt := range tests {
+		_, err := evaluate(tt.expr, NewEnv())
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) {
+			t.Errorf("evaluate(%q) error = %v, expected *CalcError", tt.expr, err)
+			continue
+		}
+		if calcErr.Code != tt.code || calcErr.Pos != tt.pos || calcErr.End != tt.end {
+			t.Errorf("evaluate(%q) error = {code %d, [%d, %d)}, expected {code %d, [%d, %d)}",
+				tt.expr, calcErr.Code, calcErr.Pos, calcErr.End, tt.code, tt.pos, tt.end)
+		}
+	}
+}
+
+func TestErrorWithoutPosition(t *testing.T) {
+	_, err := evaluatePostfix(tokensOf([]string{"1", "2"}), nil)
+	var calcErr *CalcError
+	if !errors.As(err, &calcErr) || calcErr.Code != ErrEvaluation || calcErr.Pos >= 0 {
+		t.Fatalf("evaluatePostfix error = %v, expected ErrEvaluation without position", err)
+	}
+	if got := formatDiagnostic("1 2", err); got != "Ошибка: ошибка вычисления выражения" {
+		t.Errorf("formatDiagnostic = %q", got)
+	}
+}
+
+func TestFormatDiagnostic(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"3 + (4 * 2", "3 + (4 * 2\n    ^\nОшибка: не совпадают скобки (позиция 5)"},
+		{"1 + ab$", "1 + ab$\n      ^\nОшибка: неизвестный токен: $ (позиция 7)"},
+		{"2 * speed", "2 * speed\n    ^~~~~\nОшибка: неизвестная переменная: speed (позиция 5)"},
+		{"π + 1 +", "π + 1 +\n       ^\nОшибка: выражение оборвано: пропущен операнд (позиция 8)"},
+	}
+
+	for _, tt := range tests {
+		_, err := evaluate(tt.expr, &Env{})
+		if err == nil {
+			t.Errorf("evaluate(%q) expected error", tt.expr)
+			continue
+		}
+		if got := formatDiagnostic(tt.expr, err); got != tt.expected {
+			t.Errorf("formatDiagnostic(%q) =\n%s\nexpected\n%s", tt.expr, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// function описывает встроенную функцию калькулятора.
+type function struct {
+	minArgs int // минимальное число аргументов
+	maxArgs int // максимальное число аргументов, -1 — сколько угодно
+	// apply вычисляет функцию и может переставлять args: вызывающий отдаёт срез, который ему больше не нужен
+	// (вершину стека вычислений), поэтому функции не приходится копировать аргументы
+	apply func(args []float64) (float64, error)
+}
+
+// unary оборачивает обычную функцию одного аргумента из пакета math.
+func unary(f func(float64) float64) function {
+	return function{minArgs: 1, maxArgs: 1, apply: func(args []float64) (float64, error) {
+		return f(args[0]), nil
+	}}
+}
+
+// aggregate оборачивает функцию любого числа аргументов, которой нужно не меньше minArgs.
+func aggregate(minArgs int, f func(args []float64) float64) function {
+	return function{minArgs: minArgs, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		return f(args), nil
+	}}
+}
+
+func sum(args []float64) float64 {
+	result := 0.0
+	for _, a := range args {
+		result += a
+	}
+	return result
+}
+
+func mean(args []float64) float64 {
+	return sum(args) / float64(len(args))
+}
+
+// median — среднее из упорядоченных значений; при чётном их числе — полусумма двух средних.
+// Упорядочивает сами args, поэтому в Program.Eval не выделяет память.
+func median(args []float64) float64 {
+	slices.Sort(args)
+	n := len(args)
+	if n%2 == 1 {
+		return args[n/2]
+	}
+	return (args[n/2-1] + args[n/2]) / 2
+}
+
+// variance — выборочная дисперсия: сумма квадратов отклонений от среднего, делённая на n - 1.
+func variance(args []float64) float64 {
+	m := mean(args)
+	result := 0.0
+	for _, a := range args {
+		result += (a - m) * (a - m)
+	}
+	return result / float64(len(args)-1)
+}
+
+// functions — таблица встроенных функций.
+// log(x) — десятичный логарифм, log(b, x) — логарифм x по основанию b.
+// sum, prod, avg, median, var, stddev и hypot принимают любое число аргументов, в том числе списком: sum([1, 2, 3]).
+// var и stddev — выборочные дисперсия и стандартное отклонение, им нужно хотя бы два значения.
+// re, im, conj и arg нужны прежде всего в режиме complex, для вещественных чисел они тривиальны.
+var functions = map[string]function{
+	"sqrt": unary(math.Sqrt),
+	"sin":  unary(math.Sin),
+	"cos":  unary(math.Cos),
+	"tan":  unary(math.Tan),
+	"ln":   unary(math.Log),
+	"exp":  unary(math.Exp),
+	"abs":  unary(math.Abs),
+	"re":   unary(func(x float64) float64 { return x }),
+	"conj": unary(func(x float64) float64 { return x }),
+	"im":   unary(func(float64) float64 { return 0 }),
+	"arg": unary(func(x float64) float64 {
+		if x < 0 {
+			return math.Pi
+		}
+		return 0
+	}),
+	"log": {minArgs: 1, maxArgs: 2, apply: func(args []float64) (float64, error) {
+		if len(args) == 1 {
+			return math.Log10(args[0]), nil
+		}
+		if args[0] <= 0 || args[0] == 1 {
+			return 0, fmt.Errorf("недопустимое основание логарифма: %g", args[0])
+		}
+		return math.Log(args[1]) / math.Log(args[0]), nil
+	}},
+	"min": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, a := range args[1:] {
+			result = math.Min(result, a)
+		}
+		return result, nil
+	}},
+	"max": {minArgs: 1, maxArgs: -1, apply: func(args []float64) (float64, error) {
+		result := args[0]
+		for _, a := range args[1:] {
+			result = math.Max(result, a)
+		}
+		return result, nil
+	}},
+	"sum": aggregate(1, sum),
+	"prod": aggregate(1, func(args []float64) float64 {
+		result := 1.0
+		for _, a := range args {
+			result *= a
+		}
+		return result
+	}),
+	"avg":    aggregate(1, mean),
+	"median": aggregate(1, median),
+	"var":    aggregate(2, variance),
+	"stddev": aggregate(2, func(args []float64) float64 { return math.Sqrt(variance(args)) }),
+	"hypot": aggregate(1, func(args []float64) float64 {
+		// math.Hypot по шагам не переполняется на больших аргументах
+		result := 0.0
+		for _, a := range args {
+			result = math.Hypot(result, a)
+		}
+		return result
+	}),
+}
+
+// resolver находит функцию по имени, когда разбор выражения встречает вызов.
+type resolver func(name string) (function, bool)
+
+func builtinFunction(name string) (function, bool) {
+	f, ok := functions[name]
+	return f, ok
+}
+
+func isBuiltin(name string) bool {
+	_, ok := functions[name]
+	return ok
+}
+
+// checkArity проверяет, что функции name передано допустимое число аргументов.
+func checkArity(name string, f function, argc int) error {
+	if argc < f.minArgs || f.maxArgs >= 0 && argc > f.maxArgs {
+		switch {
+		case f.maxArgs < 0:
+			return fmt.Errorf("неверное число аргументов функции %s: ожидалось не меньше %d, передано %d", name, f.minArgs, argc)
+		case f.minArgs == f.maxArgs:
+			return fmt.Errorf("неверное число аргументов функции %s: ожидалось %d, передано %d", name, f.minArgs, argc)
+		default:
+			return fmt.Errorf("неверное число аргументов функции %s: ожидалось от %d до %d, передано %d", name, f.minArgs, f.maxArgs, argc)
+		}
+	}
+	return nil
+}
+
+// checkCall проверяет, что name — известная функция и ей передано допустимое число аргументов;
+// at указывает место вызова для ошибки.
+func checkCall(at spanner, name string, argc int) error {
+	f, known := functions[name]
+	if !known {
+		return errorAt(ErrUnknownFunction, at, "неизвестная функция: %s", name)
+	}
+	if err := checkArity(name, f, argc); err != nil {
+		return errorAt(ErrArity, at, "%v", err)
+	}
+	return nil
+}
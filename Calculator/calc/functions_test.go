@@ -0,0 +1,111 @@
+package calc
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestFunctionPostfix(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"sqrt(16)", []string{"16", "sqrt(1)"}},
+		{"max(1, 2, 3)", []string{"1", "2", "3", "max(3)"}},
+		{"log(2, 8) + 1", []string{"2", "8", "log(2)", "1", "+"}},
+		{"-abs(-2)", []string{"2", unaryMinus, "abs(1)", unaryMinus}},
+		{"min(max(1, 2), 3 * 4)", []string{"1", "2", "max(2)", "3", "4", "*", "min(2)"}},
+		{"2 ^ sqrt(4)", []string{"2", "4", "sqrt(1)", "^"}},
+		{"sum([1, 2, 3])", []string{"1", "2", "3", "sum(3)"}},
+		{"avg([1, 2], 3, [])", []string{"1", "2", "3", "avg(3)"}},
+		{"max([[1], 2 + 3])", []string{"1", "2", "3", "+", "max(2)"}},
+	}
+
+	for _, tt := range tests {
+		result, err := toPostfix(tt.expr)
+		if err != nil {
+			t.Errorf("infixToPostfix(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(textsOf(result), tt.expected) {
+			t.Errorf("infixToPostfix(%q) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+}
+
+func TestFunctionEvaluation(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"sqrt(16)", 4},
+		{"sqrt(9) + sqrt(16)", 7},
+		{"sin(0)", 0},
+		{"cos(0)", 1},
+		{"tan(0)", 0},
+		{"ln(exp(2))", 2},
+		{"log(1000)", 3},
+		{"log(2, 8)", 3},
+		{"abs(-5)", 5},
+		{"min(4, -1, 7)", -1},
+		{"max(4, -1, 7)", 7},
+		{"max(3)", 3},
+		{"2 * max(1, 3 + 4) - min(2, 5)", 12},
+		{"sqrt(max(9, 2) * 4)", 6},
+		{"-sqrt(4)^2", -4},
+		{"sum(1, 2, 3)", 6},
+		{"sum([1, 2, 3]) * 2", 12},
+		{"prod([1, 2], 3, 4)", 24},
+		{"avg([2, 4, 9])", 5},
+		{"median([5, 1, 3])", 3},
+		{"median(4, 1, 3, 2)", 2.5},
+		{"var(2, 4, 4, 4, 5, 5, 7, 9)", 32.0 / 7},
+		{"stddev([1, 2, 3, 4, 5])", math.Sqrt(2.5)},
+		{"hypot(3, 4)", 5},
+		{"hypot([1, 2, 2])", 3},
+		{"min([3, 1], [2])", 1},
+	}
+
+	for _, p := range pipelines {
+		for _, tt := range tests {
+			result, err := p.eval(tt.expr, nil)
+			if err != nil {
+				t.Errorf("%s(%q) unexpected error: %v", p.name, tt.expr, err)
+				continue
+			}
+			if math.Abs(result-tt.expected) > 1e-9 {
+				t.Errorf("%s(%q) = %v, expected %v", p.name, tt.expr, result, tt.expected)
+			}
+		}
+	}
+}
+
+func TestFunctionErrors(t *testing.T) {
+	tests := []string{
+		"foo(1)",       // Неизвестная функция
+		"sqrt",         // Имя без вызова
+		"sqrt(1, 2)",   // Лишний аргумент
+		"log()",        // Нет аргументов
+		"max(1, , 2)",  // Пропущенный аргумент
+		"max(1, 2,)",   // Пропущенный последний аргумент
+		"1, 2",         // Запятая вне функции
+		"(1, 2)",       // Запятая в обычных скобках
+		"log(1, 5)",    // Недопустимое основание
+		"sum([])",      // Пустой список
+		"var(1)",       // Дисперсии нужно два значения
+		"[1, 2]",       // Список вне вызова
+		"sqrt([4])",    // Функция с фиксированным числом аргументов
+		"sum(1 + [2])", // Список внутри выражения
+		"sum([1, 2)",   // Незакрытый список
+		"sum([1, ])",   // Пропущенный элемент
+	}
+
+	for _, p := range pipelines {
+		for _, expr := range tests {
+			if _, err := p.eval(expr, nil); err == nil {
+				t.Errorf("%s(%q) expected error", p.name, expr)
+			}
+		}
+	}
+}
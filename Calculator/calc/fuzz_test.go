@@ -0,0 +1,663 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Цели для go test -fuzz. Без -fuzz они прогоняются на начальном корпусе как обычные тесты:
+//
+//	go test ./calc -run '^$' -fuzz FuzzEvaluatePostfix -fuzztime 30s
+
+// fuzzSeeds — начальный корпус: выражения из остальных тестов и заведомо ошибочные строки.
+var fuzzSeeds = []string{
+	"", "3+(4*2)-7/1", "-(2+3)*-4", "2^3^2", "2 ** -1", "!0 && 1 || 0", "x > 0 ? x : -x",
+	"1 ? 2 ? 3 : 4 : 5", "0 ? 1 : 0 ? 2 : 3", "max(1, min(x, 3), -y) + sqrt(16)", "hypot(3, 4) + abs(-2)",
+	"200 + 15%", "200 - 15%", "200 * 15%", "(15)% + 50%%", "x + (y%)", "200 + (0 ? 1 : 15%)", "7 % -3",
+	"7 mod (-3)", "-7 // 2 + 7 % 3", "1 / 0", "0 % 0", "3 + unknown", "sqrt(-1)", "2i + 1", "0 && 2i",
+	"1 in 2", "1_000.5e-3 + 0x1F - 0b101 + 0o17", ".5 + 2.", ")(", "1 +", "(1", "1)", "max(,)", "f()",
+	"1 ? 2", "1 : 2", "x = 3", "\"a\" + 1", "1e999", "pi * e", "x <= y != (y >= x) == 1 < 2",
+	"sum([1, 2], 3) + avg([x, y, [z]])", "median([])", "stddev([1, 2, 3, 4]) * var(x, y)", "[1, 2]", "sum([1] 2)",
+}
+
+// FuzzTokenize проверяет, что лексер не паникует, токены идут по порядку внутри строки
+// и совпадают со своим текстом, а разделённые пробелами токены читаются заново теми же.
+func FuzzTokenize(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		src := []rune(expr)
+		tokens, err := tokenize(expr)
+		if err != nil {
+			checkErrorSpan(t, expr, err)
+			return
+		}
+
+		end := 0
+		texts := make([]string, len(tokens))
+		for i, token := range tokens {
+			if token.Kind == TokenInvalid || token.Pos < end || token.End <= token.Pos || token.End > len(src) {
+				t.Fatalf("tokenize(%q): token %d %+v out of place", expr, i, token)
+			}
+			if got := string(src[token.Pos:token.End]); got != token.Text {
+				t.Fatalf("tokenize(%q): token %d text %q, source %q", expr, i, token.Text, got)
+			}
+			// Число вне диапазона float64 лексер отмечает значением +Inf
+			if token.Kind == TokenNumber && (token.Value < 0 || math.IsNaN(token.Value)) {
+				t.Fatalf("tokenize(%q): number %q = %v", expr, token.Text, token.Value)
+			}
+			end = token.End
+			texts[i] = token.Text
+		}
+
+		joined := strings.Join(texts, " ")
+		again, err := tokenize(joined)
+		if err != nil || len(again) != len(tokens) {
+			t.Fatalf("tokenize(%q) = %v, %v; expected %d tokens", joined, textsOf(again), err, len(tokens))
+		}
+		for i := range tokens {
+			if !sameToken(again[i], tokens[i]) {
+				t.Fatalf("tokenize(%q): token %d = %+v, expected %+v", joined, i, again[i], tokens[i])
+			}
+		}
+	})
+}
+
+// FuzzInfixToPostfix проверяет, что разбор не паникует, напечатанная постфиксная запись читается обратно
+// в те же токены, а дерево, напечатанное Format, разбирается в то же дерево.
+func FuzzInfixToPostfix(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		tokens, err := tokenize(expr)
+		if err != nil {
+			return
+		}
+		postfix, err := infixToPostfix(tokens)
+		if err != nil {
+			checkErrorSpan(t, expr, err)
+			return
+		}
+		if len(postfix) == 0 {
+			return
+		}
+
+		printed := strings.Join(textsOf(postfix), " ")
+		read, err := readPostfix(printed)
+		if err != nil {
+			t.Fatalf("readPostfix(%q) for %q: %v", printed, expr, err)
+		}
+		if !slices.EqualFunc(read, postfix, sameToken) {
+			t.Fatalf("readPostfix(%q) = %v, expected %v", printed, textsOf(read), textsOf(postfix))
+		}
+
+		tree, err := buildTree(postfix)
+		var calcErr *CalcError
+		if errors.As(err, &calcErr) && calcErr.Code == ErrMalformedNumber {
+			return // в дереве только числа float64, 1e400 в него не попадает
+		}
+		if err != nil {
+			t.Fatalf("buildTree(%q = %v): %v", expr, printed, err)
+		}
+		infix := Format(tree)
+		reparsed, err := ParseTree(infix)
+		if err != nil {
+			t.Fatalf("ParseTree(Format(%q) = %q): %v", expr, infix, err)
+		}
+		if again := Format(reparsed); again != infix {
+			t.Fatalf("Format(ParseTree(%q)) = %q for %q", infix, again, expr)
+		}
+	})
+}
+
+// FuzzEvaluatePostfix сверяет evaluatePostfix с независимым вычислителем рекурсивным спуском,
+// с вычислением по дереву и с байт-кодом: значения должны совпадать с точностью до погрешности,
+// ошибки — по коду.
+func FuzzEvaluatePostfix(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, expr string) {
+		tokens, err := tokenize(expr)
+		if err != nil || len(tokens) == 0 {
+			return
+		}
+		postfix, err := infixToPostfix(tokens)
+		if err != nil {
+			return
+		}
+		env := fuzzEnv()
+		want, wantErr := evaluatePostfix(postfix, env)
+
+		eval, err := (&refParser{tokens: tokens, env: env}).parse()
+		if err != nil {
+			t.Fatalf("reference parser rejects %q accepted by infixToPostfix: %v", expr, err)
+		}
+		got, gotErr := eval()
+		checkSame(t, expr, "reference", got, gotErr, want, wantErr)
+
+		// buildTree, как и Compile, проверяет все литералы до вычисления: дерево с числом вне диапазона
+		// float64 не строится. evaluatePostfix проверяет литерал, только дойдя до него, поэтому раньше
+		// может сообщить другую ошибку, а 0 && 1e400 и вовсе вычисляет. Расхождение намеренное,
+		// и сравнение с деревом в этом случае пропускается
+		tree, err := buildTree(postfix)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != ErrMalformedNumber {
+			if err == nil {
+				got, gotErr = evalTree(tree, env)
+			} else {
+				got, gotErr = 0, err
+			}
+			checkSame(t, expr, "evalTree", got, gotErr, want, wantErr)
+		}
+
+		// Байт-код не знает мнимых чисел и оператора in, такие выражения он отвергает ещё при компиляции,
+		// как и числа вне диапазона float64
+		p, err := Compile(expr)
+		if err != nil {
+			return
+		}
+		vars := make([]float64, 0, len(p.Vars()))
+		for _, name := range p.Vars() {
+			value, ok := env.Get(name)
+			if !ok {
+				return
+			}
+			vars = append(vars, value)
+		}
+		got, gotErr = p.Eval(vars)
+		checkSame(t, expr, "Program.Eval", got, gotErr, want, wantErr)
+	})
+}
+
+func fuzzEnv() *Env {
+	env := NewEnv()
+	env.Set("x", 1.5)
+	env.Set("y", -2)
+	env.Set("z", 0)
+	return env
+}
+
+// checkErrorSpan проверяет, что ошибка — *CalcError и её место лежит внутри выражения
+// (ошибка «выражение оборвано» указывает на символ сразу за его концом).
+func checkErrorSpan(t *testing.T, expr string, err error) {
+	t.Helper()
+	var calcErr *CalcError
+	if !errors.As(err, &calcErr) {
+		t.Fatalf("%q: error %v is not *CalcError", expr, err)
+	}
+	if calcErr.Pos < 0 || calcErr.End <= calcErr.Pos || calcErr.Pos > len([]rune(expr)) {
+		t.Fatalf("%q: error %v at %d..%d", expr, err, calcErr.Pos, calcErr.End)
+	}
+}
+
+// checkSame сравнивает результат вычислителя name с результатом evaluatePostfix.
+func checkSame(t *testing.T, expr, name string, got float64, gotErr error, want float64, wantErr error) {
+	t.Helper()
+	if wantErr != nil || gotErr != nil {
+		var gotCalc, wantCalc *CalcError
+		if !errors.As(gotErr, &gotCalc) || !errors.As(wantErr, &wantCalc) || gotCalc.Code != wantCalc.Code {
+			t.Fatalf("%s(%q) error = %v, evaluatePostfix error = %v", name, expr, gotErr, wantErr)
+		}
+		return
+	}
+	if !closeEnough(got, want) {
+		t.Fatalf("%s(%q) = %v, evaluatePostfix = %v", name, expr, got, want)
+	}
+}
+
+// closeEnough сравнивает числа с относительной погрешностью 1e-9; NaN равен NaN, бесконечность — только себе.
+func closeEnough(a, b float64) bool {
+	switch {
+	case math.IsNaN(a) || math.IsNaN(b):
+		return math.IsNaN(a) && math.IsNaN(b)
+	case math.IsInf(a, 0) || math.IsInf(b, 0):
+		return a == b
+	}
+	return math.Abs(a-b) <= 1e-9*max(1, math.Abs(a), math.Abs(b))
+}
+
+func sameToken(a, b Token) bool {
+	return a.Kind == b.Kind && a.Text == b.Text && a.Argc == b.Argc && a.Value == b.Value
+}
+
+// readPostfix читает постфиксную запись, напечатанную через Token.String и разделённую пробелами:
+// "2 3 u- ^", "x ?[3] 1 :[1] 0", "max(2)". Места токенов не восстанавливаются.
+func readPostfix(text string) ([]Token, error) {
+	var tokens []Token
+	for _, field := range strings.Fields(text) {
+		token := Token{Kind: TokenOperator, Text: field}
+		if name, argc, ok := strings.Cut(field, "["); ok && strings.HasSuffix(argc, "]") {
+			token.Text, token.Kind = name, TokenJumpIfFalse
+			if name == ":" {
+				token.Kind = TokenJump
+			}
+			n, err := strconv.Atoi(strings.TrimSuffix(argc, "]"))
+			if err != nil {
+				return nil, err
+			}
+			token.Argc = n
+		} else if name, argc, ok := strings.Cut(field, "("); ok && name != "" && strings.HasSuffix(argc, ")") {
+			n, err := strconv.Atoi(strings.TrimSuffix(argc, ")"))
+			if err != nil {
+				return nil, err
+			}
+			token = Token{Kind: TokenCall, Text: name, Argc: n}
+		} else if _, ok := builtinOperators.lookup(field); !ok && field != toBoolean {
+			lexed, err := tokenize(field)
+			if err != nil || len(lexed) != 1 {
+				return nil, fmt.Errorf("не токен: %q", field)
+			}
+			token = Token{Kind: lexed[0].Kind, Text: lexed[0].Text, Value: lexed[0].Value}
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// refParser — вычислитель рекурсивным спуском по токенам tokenize, написанный независимо от
+// infixToPostfix, чтобы сверять с ним постфиксную запись. Грамматика, от слабых операторов к сильным:
+//
+//	cond    = or [ "?" cond ":" cond ]
+//	or      = and { ("||" | "in") and }
+//	and     = cmp { "&&" cmp }
+//	cmp     = sum { ("==" | "!=" | "<" | "<=" | ">" | ">=") sum }
+//	sum     = product { ("+" | "-") product }            x ± y% = x * (1 ± y/100)
+//	product = unary { ("*" | "/" | "%" | "mod" | "//") unary }
+//	unary   = ("-" | "+" | "!") unary | power                 +y% — по-прежнему процент
+//	power   = percent [ ("^" | "**") unary ]
+//	percent = primary { "%" }                             % без следующего операнда — процент
+//	primary = number | name | name "(" [ args ] ")" | "(" cond ")"
+//	args    = arg { "," arg }
+//	arg     = cond | "[" [ args ] "]"                      элементы списка — отдельные аргументы
+//
+// Разбор строит замыкания, поэтому &&, || и ?: вычисляют только нужную часть, как переходы постфиксной записи.
+type refParser struct {
+	tokens []Token
+	pos    int
+	env    *Env
+}
+
+type refThunk func() (float64, error)
+
+// refExpr — разобранное подвыражение; percent — оно целиком процент y%, возможно в скобках, y — значение до деления на 100.
+type refExpr struct {
+	eval    refThunk
+	percent bool
+	y       refThunk
+}
+
+func (p *refParser) parse() (refThunk, error) {
+	e, err := p.cond()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("лишний токен %q", p.tokens[p.pos].Text)
+	}
+	return e.eval, nil
+}
+
+// accept пропускает текущий токен, если он вида kind и (для операторов) с одним из texts.
+func (p *refParser) accept(kind TokenKind, texts ...string) (Token, bool) {
+	if p.pos >= len(p.tokens) {
+		return Token{}, false
+	}
+	token := p.tokens[p.pos]
+	if token.Kind != kind || len(texts) > 0 && !slices.Contains(texts, token.Text) {
+		return Token{}, false
+	}
+	p.pos++
+	return token, true
+}
+
+func (p *refParser) expect(kind TokenKind) error {
+	if _, ok := p.accept(kind); !ok {
+		return fmt.Errorf("ожидался %v на %d", kind, p.pos)
+	}
+	return nil
+}
+
+func (p *refParser) cond() (refExpr, error) {
+	c, err := p.or()
+	if err != nil {
+		return c, err
+	}
+	if _, ok := p.accept(TokenQuestion); !ok {
+		return c, nil
+	}
+	a, err := p.cond()
+	if err != nil {
+		return a, err
+	}
+	if err := p.expect(TokenColon); err != nil {
+		return refExpr{}, err
+	}
+	b, err := p.cond()
+	if err != nil {
+		return b, err
+	}
+	return refExpr{eval: func() (float64, error) {
+		v, err := c.eval()
+		if err != nil {
+			return 0, err
+		}
+		if v != 0 {
+			return a.eval()
+		}
+		return b.eval()
+	}}, nil
+}
+
+// refBinary вычисляет бинарный оператор; операнды передаются невычисленными ради && и ||.
+type refBinary func(tok Token, l, r refThunk) (float64, error)
+
+// level разбирает левоассоциативную цепочку операндов next через операторы ops.
+func (p *refParser) level(next func() (refExpr, error), ops map[string]refBinary) (refExpr, error) {
+	left, err := next()
+	if err != nil {
+		return left, err
+	}
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		apply, ok := ops[tok.Text]
+		if !ok || tok.Kind != TokenOperator {
+			break
+		}
+		p.pos++
+		right, err := next()
+		if err != nil {
+			return right, err
+		}
+		l, r := left.eval, right.eval
+		left = refExpr{eval: func() (float64, error) { return apply(tok, l, r) }}
+	}
+	return left, nil
+}
+
+// refStrict превращает обычную функцию двух аргументов в refBinary, вычисляющий оба операнда.
+func refStrict(f func(tok Token, a, b float64) (float64, error)) refBinary {
+	return func(tok Token, l, r refThunk) (float64, error) {
+		a, err := l()
+		if err != nil {
+			return 0, err
+		}
+		b, err := r()
+		if err != nil {
+			return 0, err
+		}
+		return f(tok, a, b)
+	}
+}
+
+func refBool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (p *refParser) or() (refExpr, error) {
+	return p.level(p.and, map[string]refBinary{
+		"||": func(_ Token, l, r refThunk) (float64, error) {
+			a, err := l()
+			if err != nil || a != 0 {
+				return 1, err
+			}
+			b, err := r()
+			return refBool(b != 0), err
+		},
+		"in": refStrict(func(tok Token, _, _ float64) (float64, error) {
+			return 0, errorAt(ErrDimension, tok, "in без единиц")
+		}),
+	})
+}
+
+func (p *refParser) and() (refExpr, error) {
+	return p.level(p.cmp, map[string]refBinary{
+		"&&": func(_ Token, l, r refThunk) (float64, error) {
+			a, err := l()
+			if err != nil || a == 0 {
+				return 0, err
+			}
+			b, err := r()
+			return refBool(b != 0), err
+		},
+	})
+}
+
+func (p *refParser) cmp() (refExpr, error) {
+	compare := func(f func(a, b float64) bool) refBinary {
+		return refStrict(func(_ Token, a, b float64) (float64, error) { return refBool(f(a, b)), nil })
+	}
+	return p.level(p.sum, map[string]refBinary{
+		"==": compare(func(a, b float64) bool { return a == b }),
+		"!=": compare(func(a, b float64) bool { return a != b }),
+		"<":  compare(func(a, b float64) bool { return a < b }),
+		"<=": compare(func(a, b float64) bool { return a <= b }),
+		">":  compare(func(a, b float64) bool { return a > b }),
+		">=": compare(func(a, b float64) bool { return a >= b }),
+	})
+}
+
+// sum разбирается отдельно от level: правая часть, целиком записанная процентом, — процент от левой.
+func (p *refParser) sum() (refExpr, error) {
+	left, err := p.product()
+	if err != nil {
+		return left, err
+	}
+	for {
+		tok, ok := p.accept(TokenOperator, "+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.product()
+		if err != nil {
+			return right, err
+		}
+		l, r, minus := left.eval, right, tok.Text == "-"
+		left = refExpr{eval: func() (float64, error) {
+			a, err := l()
+			if err != nil {
+				return 0, err
+			}
+			if r.percent {
+				// x ± y% = x * (100 ± y) / 100
+				y, err := r.y()
+				if err != nil {
+					return 0, err
+				}
+				if minus {
+					y = -y
+				}
+				return a * (y + 100) / 100, nil
+			}
+			b, err := r.eval()
+			if err != nil {
+				return 0, err
+			}
+			switch {
+			case minus:
+				return a - b, nil
+			}
+			return a + b, nil
+		}}
+	}
+}
+
+func (p *refParser) product() (refExpr, error) {
+	divide := func(f func(a, b float64) float64) refBinary {
+		return refStrict(func(tok Token, a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+			}
+			return f(a, b), nil
+		})
+	}
+	mod := divide(func(a, b float64) float64 {
+		// Остаток со знаком делителя
+		m := math.Mod(a, b)
+		if m != 0 && math.Signbit(m) != math.Signbit(b) {
+			m += b
+		}
+		return m
+	})
+	return p.level(p.unary, map[string]refBinary{
+		"*":   refStrict(func(_ Token, a, b float64) (float64, error) { return a * b, nil }),
+		"/":   divide(func(a, b float64) float64 { return a / b }),
+		"%":   mod,
+		"mod": mod,
+		"//":  divide(func(a, b float64) float64 { return math.Floor(a / b) }),
+	})
+}
+
+func (p *refParser) unary() (refExpr, error) {
+	tok, ok := p.accept(TokenOperator, "-", "+", "!")
+	if !ok {
+		return p.power()
+	}
+	x, err := p.unary()
+	if err != nil {
+		return x, err
+	}
+	switch tok.Text {
+	case "-":
+		return refExpr{eval: func() (float64, error) {
+			v, err := x.eval()
+			return -v, err
+		}}, nil
+	case "!":
+		return refExpr{eval: func() (float64, error) {
+			v, err := x.eval()
+			return refBool(v == 0), err
+		}}, nil
+	}
+	return x, nil // унарный плюс ничего не меняет: 200 + +15% — тоже процент от 200
+}
+
+func (p *refParser) power() (refExpr, error) {
+	base, err := p.percent()
+	if err != nil {
+		return base, err
+	}
+	if _, ok := p.accept(TokenOperator, "^", "**"); !ok {
+		return base, nil
+	}
+	exp, err := p.unary()
+	if err != nil {
+		return exp, err
+	}
+	return refExpr{eval: func() (float64, error) {
+		a, err := base.eval()
+		if err != nil {
+			return 0, err
+		}
+		b, err := exp.eval()
+		return math.Pow(a, b), err
+	}}, nil
+}
+
+func (p *refParser) percent() (refExpr, error) {
+	x, err := p.primary()
+	if err != nil {
+		return x, err
+	}
+	for p.pos < len(p.tokens) && p.tokens[p.pos].Kind == TokenOperator && p.tokens[p.pos].Text == "%" &&
+		!startsOperand(p.tokens[p.pos+1:]) {
+		p.pos++
+		inner := x.eval
+		x = refExpr{percent: true, y: inner, eval: func() (float64, error) {
+			v, err := inner()
+			return v / 100, err
+		}}
+	}
+	return x, nil
+}
+
+func (p *refParser) primary() (refExpr, error) {
+	if p.pos >= len(p.tokens) {
+		return refExpr{}, errors.New("выражение оборвано")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+
+	switch tok.Kind {
+	case TokenNumber:
+		return refExpr{eval: func() (float64, error) {
+			if math.IsInf(tok.Value, 0) {
+				return 0, errorAt(ErrMalformedNumber, tok, "число вне диапазона")
+			}
+			return tok.Value, nil
+		}}, nil
+
+	case TokenImag:
+		return refExpr{eval: func() (float64, error) { return 0, errorAt(ErrDomain, tok, "мнимое число") }}, nil
+
+	case TokenLParen:
+		x, err := p.cond()
+		if err != nil {
+			return x, err
+		}
+		return x, p.expect(TokenRParen)
+
+	case TokenIdent:
+		if _, ok := p.accept(TokenLParen); !ok {
+			return refExpr{eval: func() (float64, error) {
+				v, ok := p.env.Get(tok.Text)
+				if !ok {
+					return 0, errorAt(ErrUndefinedVariable, tok, "нет переменной %s", tok.Text)
+				}
+				return v, nil
+			}}, nil
+		}
+		args, err := p.args(TokenRParen)
+		if err != nil {
+			return refExpr{}, err
+		}
+		return refExpr{eval: func() (float64, error) {
+			values := make([]float64, len(args))
+			for i, arg := range args {
+				v, err := arg()
+				if err != nil {
+					return 0, err
+				}
+				values[i] = v
+			}
+			return callFunction(tok, tok.Text, values)
+		}}, nil
+	}
+	return refExpr{}, fmt.Errorf("неожиданный токен %q", tok.Text)
+}
+
+// args читает аргументы вызова или элементы списка до закрывающей скобки closing, раскрывая вложенные списки.
+func (p *refParser) args(closing TokenKind) ([]refThunk, error) {
+	var args []refThunk
+	if _, ok := p.accept(closing); ok {
+		return nil, nil
+	}
+	for {
+		if _, ok := p.accept(TokenLBracket); ok {
+			list, err := p.args(TokenRBracket)
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, list...)
+		} else {
+			arg, err := p.cond()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg.eval)
+		}
+		if _, ok := p.accept(TokenComma); !ok {
+			return args, p.expect(closing)
+		}
+	}
+}
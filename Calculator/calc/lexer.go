@@ -0,0 +1,382 @@
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// TokenKind — вид токена.
+type TokenKind int
+
+const (
+	TokenInvalid     TokenKind = iota // нулевое значение, лексер такие токены не выдаёт
+	TokenNumber                       // число, значение уже разобрано в Value
+	TokenImag                         // мнимое число вида 4i, в Value — коэффициент при i
+	TokenOperator                     // оператор: арифметический, сравнение, && || ! и унарный минус в постфиксной записи
+	TokenLParen                       // (
+	TokenRParen                       // )
+	TokenIdent                        // имя переменной или функции
+	TokenComma                        // запятая между аргументами функции
+	TokenAssign                       // = в присваивании
+	TokenCall                         // вызов функции в постфиксной записи, число аргументов в Argc
+	TokenQuestion                     // ? в условном выражении c ? a : b
+	TokenColon                        // : в условном выражении
+	TokenJumpIfFalse                  // переход в постфиксной записи: снять условие и, если оно ложно, пропустить Argc токенов
+	TokenJump                         // безусловный переход в постфиксной записи: пропустить Argc токенов
+	TokenUnit                         // единица измерения в режиме units: m, km, s
+	TokenLBracket                     // [ в начале списка
+	TokenRBracket                     // ] в конце списка
+)
+
+var tokenKindNames = [...]string{
+	TokenInvalid:  "invalid",
+	TokenNumber:   "number",
+	TokenImag:     "imag",
+	TokenOperator: "operator",
+	TokenLParen:   "lparen",
+	TokenRParen:   "rparen",
+	TokenIdent:    "ident",
+	TokenComma:    "comma",
+	TokenAssign:   "assign",
+	TokenCall:     "call",
+
+	TokenQuestion:    "question",
+	TokenColon:       "colon",
+	TokenJumpIfFalse: "jump-if-false",
+	TokenJump:        "jump",
+	TokenUnit:        "unit",
+	TokenLBracket:    "lbracket",
+	TokenRBracket:    "rbracket",
+}
+
+func (k TokenKind) String() string {
+	if k >= 0 && int(k) < len(tokenKindNames) {
+		return tokenKindNames[k]
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// Token — токен выражения вместе с его местом в исходной строке.
+// Pos и End — номера символов (рун) начала и конца токена, End не включается.
+type Token struct {
+	Kind  TokenKind
+	Text  string
+	Value float64 // значение числа для TokenNumber и TokenImag; +Inf — число вне диапазона float64
+	Argc  int     // число аргументов для TokenCall, длина перехода для TokenJumpIfFalse и TokenJump
+	Pos   int
+	End   int
+}
+
+// String печатает токен так, как он выглядит в постфиксной записи: вызов функции — вместе с числом аргументов,
+// переход — с числом пропускаемых токенов: "?[3]", ":[1]".
+func (t Token) String() string {
+	switch t.Kind {
+	case TokenCall:
+		return t.Text + "(" + strconv.Itoa(t.Argc) + ")"
+	case TokenJumpIfFalse, TokenJump:
+		return t.Text + "[" + strconv.Itoa(t.Argc) + "]"
+	}
+	return t.Text
+}
+
+func (t Token) span() Span {
+	return Span{Pos: t.Pos, End: t.End}
+}
+
+// lexer разбирает строку выражения на токены.
+type lexer struct {
+	src    []rune
+	pos    int
+	tokens []Token
+	ops    *OperatorSet
+}
+
+// tokenize разбивает строку выражения на отдельные токены.
+// Например, "3+(4*2)-7/1" преобразуется в: ["3", "+", "(", "4", "*", "2", ")", "-", "7", "/", "1"].
+// Две звёздочки подряд ("**") дают один токен возведения в степень,
+// последовательность букв, цифр и "_", начинающаяся с буквы, — один токен-имя ("sqrt", "x1").
+// Числа разбираются сразу, поэтому "1.2.3", одинокая точка, "1e", "0b102" или незнакомый символ
+// дают *CalcError ещё до разбора выражения.
+func tokenize(expr string) ([]Token, error) {
+	return tokenizeWith(expr, builtinOperators)
+}
+
+// tokenizeWith — tokenize, в котором операторы берутся из набора ops: слово-оператор вроде "mod"
+// становится TokenOperator, а знаки читаются самой длинной записью оператора из набора.
+func tokenizeWith(expr string, ops *OperatorSet) ([]Token, error) {
+
+	l := &lexer{src: []rune(expr), ops: ops}
+
+	for l.pos < len(l.src) {
+		ch := l.src[l.pos]
+		switch {
+		case unicode.IsSpace(ch):
+			l.pos++
+		case unicode.IsDigit(ch) || ch == '.':
+			if err := l.number(); err != nil {
+				return nil, err
+			}
+		case isIdentStart(ch):
+			l.ident()
+		default:
+			if err := l.symbol(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return l.tokens, nil
+
+}
+
+// emit добавляет токен, занимающий символы с start до текущей позиции.
+func (l *lexer) emit(kind TokenKind, start int) *Token {
+	l.tokens = append(l.tokens, Token{Kind: kind, Text: string(l.src[start:l.pos]), Pos: start, End: l.pos})
+	return &l.tokens[len(l.tokens)-1]
+}
+
+// number читает числовой литерал:
+// десятичный — 12, 3.5, .5, 2., с показателем степени 1e-3, 6.02E23;
+// целый с префиксом основания — 0xFF, 0o17, 0b1010.
+// Цифры можно разделять одиночными "_": 1_000_000, 0xFF_FF.
+// Буква i сразу после числа делает его мнимым: "4i", "0.5i".
+func (l *lexer) number() error {
+
+	start := l.pos
+	var value float64
+	var err error
+	if base := l.basePrefix(); base != 0 {
+		value, err = l.prefixed(base)
+	} else {
+		value, err = l.decimal()
+	}
+	if err != nil {
+		return err
+	}
+
+	kind := TokenNumber
+	if l.imagSuffix() {
+		kind = TokenImag
+		l.pos++
+	}
+	l.emit(kind, start).Value = value
+	return nil
+}
+
+// basePrefix возвращает основание, если с текущей позиции начинается префикс 0x, 0o или 0b, и 0 иначе.
+func (l *lexer) basePrefix() int {
+	if l.src[l.pos] != '0' || l.pos+1 >= len(l.src) {
+		return 0
+	}
+	switch unicode.ToLower(l.src[l.pos+1]) {
+	case 'x':
+		return 16
+	case 'o':
+		return 8
+	case 'b':
+		return 2
+	}
+	return 0
+}
+
+// imagSuffix сообщает, стоит ли на текущей позиции отдельная буква i — признак мнимого числа.
+func (l *lexer) imagSuffix() bool {
+	return l.pos < len(l.src) && l.src[l.pos] == 'i' && (l.pos+1 == len(l.src) || !isIdentPart(l.src[l.pos+1]))
+}
+
+// decimal читает десятичное число: цифры с не более чем одной точкой и необязательный показатель степени.
+func (l *lexer) decimal() (float64, error) {
+
+	start := l.pos
+	digits, dots := 0, 0
+	for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '.' || l.src[l.pos] == '_') {
+		switch l.src[l.pos] {
+		case '.':
+			dots++
+		case '_':
+			if err := l.separator(start, 10); err != nil {
+				return 0, err
+			}
+		default:
+			digits++
+		}
+		l.pos++
+	}
+
+	if dots > 1 || digits == 0 {
+		return 0, l.malformed(start, "некорректное число: %s", nil)
+	}
+
+	if l.pos < len(l.src) && (l.src[l.pos] == 'e' || l.src[l.pos] == 'E') {
+		expStart := l.pos
+		l.pos++
+		if l.pos < len(l.src) && (l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		expDigits := 0
+		for l.pos < len(l.src) && (unicode.IsDigit(l.src[l.pos]) || l.src[l.pos] == '_') {
+			if l.src[l.pos] == '_' {
+				if err := l.separator(expStart, 10); err != nil {
+					return 0, err
+				}
+			} else {
+				expDigits++
+			}
+			l.pos++
+		}
+		if expDigits == 0 {
+			return 0, &CalcError{Code: ErrMalformedNumber, Pos: expStart, End: l.pos,
+				Msg: "в показателе степени нет цифр: " + string(l.src[start:l.pos])}
+		}
+	}
+
+	text := strings.ReplaceAll(string(l.src[start:l.pos]), "_", "")
+	value, err := strconv.ParseFloat(text, 64)
+	if errors.Is(err, strconv.ErrRange) && math.IsInf(value, 0) {
+		return value, nil // режимы rat и big прочитают его из текста, остальные откажут в inRange
+	}
+	if err != nil {
+		return 0, l.malformed(start, "некорректное число: %s", err)
+	}
+	return value, nil
+}
+
+// prefixed читает целое число с префиксом основания. Буквы и цифры, недопустимые в этом основании,
+// считаются частью числа и дают ошибку с указанием на них: в 0b102 подчёркнута двойка.
+func (l *lexer) prefixed(base int) (float64, error) {
+
+	start := l.pos
+	l.pos += 2 // префикс
+	digits := 0
+	for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) && !l.imagSuffix() {
+		ch := l.src[l.pos]
+		switch {
+		case ch == '_':
+			if err := l.separator(start+2, base); err != nil {
+				return 0, err
+			}
+		case isDigitOf(ch, base):
+			digits++
+		default:
+			return 0, &CalcError{Code: ErrMalformedNumber, Pos: l.pos, End: l.pos + 1,
+				Msg: fmt.Sprintf("недопустимая цифра %q в числе по основанию %d", ch, base)}
+		}
+		l.pos++
+	}
+
+	if digits == 0 {
+		return 0, l.malformed(start, "нет цифр после префикса: %s", nil)
+	}
+
+	text := strings.ReplaceAll(string(l.src[start+2:l.pos]), "_", "")
+	n, _ := new(big.Int).SetString(text, base)
+	value, _ := new(big.Float).SetInt(n).Float64()
+	return value, nil
+}
+
+// inRange проверяет, что число помещается в float64. Лексер не отвергает большие литералы сам:
+// 1e400 — обычное число в режимах rat и big, а в остальных это ошибка при вычислении.
+func inRange(tok Token) error {
+	if math.IsInf(tok.Value, 0) {
+		return errorAt(ErrMalformedNumber, tok, "число вне диапазона float64: %s", tok.Text)
+	}
+	return nil
+}
+
+// separator проверяет разделитель "_" на текущей позиции: он должен стоять между двумя цифрами числа,
+// начинающегося с first.
+func (l *lexer) separator(first, base int) error {
+	prevOK := l.pos > first && isDigitOf(l.src[l.pos-1], base)
+	nextOK := l.pos+1 < len(l.src) && isDigitOf(l.src[l.pos+1], base)
+	if !prevOK || !nextOK {
+		return &CalcError{Code: ErrMalformedNumber, Pos: l.pos, End: l.pos + 1, Msg: "разделитель _ должен стоять между цифрами"}
+	}
+	return nil
+}
+
+// malformed создаёт ошибку для числа, занимающего символы с start до текущей позиции.
+func (l *lexer) malformed(start int, format string, err error) *CalcError {
+	return &CalcError{Code: ErrMalformedNumber, Pos: start, End: l.pos,
+		Msg: fmt.Sprintf(format, string(l.src[start:l.pos])), Err: err}
+}
+
+// isDigitOf сообщает, является ли символ цифрой в системе счисления с основанием base (до 16).
+func isDigitOf(ch rune, base int) bool {
+	value := base
+	switch {
+	case '0' <= ch && ch <= '9':
+		value = int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		value = int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		value = int(ch-'A') + 10
+	}
+	return value < base
+}
+
+// ident читает имя: буквы, цифры и "_", начиная с буквы или "_".
+// Имя, совпадающее со словом-оператором набора (например, "mod"), становится оператором.
+func (l *lexer) ident() {
+	start := l.pos
+	for l.pos < len(l.src) && isIdentPart(l.src[l.pos]) {
+		l.pos++
+	}
+	if l.ops.isSymbol(string(l.src[start:l.pos])) {
+		l.emit(TokenOperator, start)
+		return
+	}
+	l.emit(TokenIdent, start)
+}
+
+// symbol читает круглую или квадратную скобку, запятую, "?", ":", присваивание или оператор.
+// Из записей операторов выбирается самая длинная: "<=" — один токен, а не "<" и "=".
+func (l *lexer) symbol() error {
+
+	start := l.pos
+	ch := l.src[l.pos]
+
+	if n := l.ops.longestSymbol(l.src[l.pos:]); n > 0 {
+		l.pos += n
+		l.emit(TokenOperator, start)
+		return nil
+	}
+	l.pos++
+
+	switch ch {
+	case '(':
+		l.emit(TokenLParen, start)
+	case ')':
+		l.emit(TokenRParen, start)
+	case '[':
+		l.emit(TokenLBracket, start)
+	case ']':
+		l.emit(TokenRBracket, start)
+	case ',':
+		l.emit(TokenComma, start)
+	case '?':
+		l.emit(TokenQuestion, start)
+	case ':':
+		l.emit(TokenColon, start)
+	case '=':
+		l.emit(TokenAssign, start)
+	case '&', '|':
+		return &CalcError{Code: ErrUnknownToken, Pos: start, End: l.pos,
+			Msg: fmt.Sprintf("неизвестный токен: %c, логический оператор пишется как %c%c", ch, ch, ch)}
+	default:
+		return &CalcError{Code: ErrUnknownToken, Pos: start, End: l.pos, Msg: "неизвестный токен: " + string(ch)}
+	}
+	return nil
+}
+
+func isIdentStart(ch rune) bool {
+	return unicode.IsLetter(ch) || ch == '_'
+}
+
+func isIdentPart(ch rune) bool {
+	return isIdentStart(ch) || unicode.IsDigit(ch)
+}
@@ -0,0 +1,166 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLexerKinds(t *testing.T) {
+	tokens, err := tokenize("x = max(.5, 2.) ** -1")
+	if err != nil {
+		t.Fatalf("tokenize unexpected error: %v", err)
+	}
+	expected := []struct {
+		kind  TokenKind
+		text  string
+		value float64
+	}{
+		{TokenIdent, "x", 0},
+		{TokenAssign, "=", 0},
+		{TokenIdent, "max", 0},
+		{TokenLParen, "(", 0},
+		{TokenNumber, ".5", 0.5},
+		{TokenComma, ",", 0},
+		{TokenNumber, "2.", 2},
+		{TokenRParen, ")", 0},
+		{TokenOperator, "**", 0},
+		{TokenOperator, "-", 0},
+		{TokenNumber, "1", 1},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("tokenize returned %v, expected %d tokens", tokens, len(expected))
+	}
+	for i, want := range expected {
+		got := tokens[i]
+		if got.Kind != want.kind || got.Text != want.text || got.Value != want.value {
+			t.Errorf("token %d = {%d %q %v}, expected {%d %q %v}", i, got.Kind, got.Text, got.Value, want.kind, want.text, want.value)
+		}
+	}
+}
+
+func TestLexerLogicalOperators(t *testing.T) {
+	tokens, err := tokenize("!a<=b&&c!=1||d>=2?x:y==z<w>v")
+	if err != nil {
+		t.Fatalf("tokenize unexpected error: %v", err)
+	}
+	expected := []struct {
+		kind TokenKind
+		text string
+	}{
+		{TokenOperator, "!"}, {TokenIdent, "a"}, {TokenOperator, "<="}, {TokenIdent, "b"},
+		{TokenOperator, "&&"}, {TokenIdent, "c"}, {TokenOperator, "!="}, {TokenNumber, "1"},
+		{TokenOperator, "||"}, {TokenIdent, "d"}, {TokenOperator, ">="}, {TokenNumber, "2"},
+		{TokenQuestion, "?"}, {TokenIdent, "x"}, {TokenColon, ":"}, {TokenIdent, "y"},
+		{TokenOperator, "=="}, {TokenIdent, "z"}, {TokenOperator, "<"}, {TokenIdent, "w"},
+		{TokenOperator, ">"}, {TokenIdent, "v"},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("tokenize returned %v, expected %d tokens", tokens, len(expected))
+	}
+	for i, want := range expected {
+		if got := tokens[i]; got.Kind != want.kind || got.Text != want.text {
+			t.Errorf("token %d = {%v %q}, expected {%v %q}", i, got.Kind, got.Text, want.kind, want.text)
+		}
+	}
+}
+
+func TestLexerArithmeticOperators(t *testing.T) {
+	tokens, err := tokenize("a//b%c mod d/e")
+	if err != nil {
+		t.Fatalf("tokenize unexpected error: %v", err)
+	}
+	expected := []struct {
+		kind TokenKind
+		text string
+	}{
+		{TokenIdent, "a"}, {TokenOperator, "//"}, {TokenIdent, "b"}, {TokenOperator, "%"}, {TokenIdent, "c"},
+		{TokenOperator, "mod"}, {TokenIdent, "d"}, {TokenOperator, "/"}, {TokenIdent, "e"},
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("tokenize returned %v, expected %d tokens", tokens, len(expected))
+	}
+	for i, want := range expected {
+		if got := tokens[i]; got.Kind != want.kind || got.Text != want.text {
+			t.Errorf("token %d = {%v %q}, expected {%v %q}", i, got.Kind, got.Text, want.kind, want.text)
+		}
+	}
+}
+
+func TestLexerLiterals(t *testing.T) {
+	tests := []struct {
+		text  string
+		kind  TokenKind
+		value float64
+	}{
+		{"1e-3", TokenNumber, 0.001},
+		{"6.02E23", TokenNumber, 6.02e23},
+		{"2.5e+2", TokenNumber, 250},
+		{".5e1", TokenNumber, 5},
+		{"0xFF", TokenNumber, 255},
+		{"0XfF", TokenNumber, 255},
+		{"0o17", TokenNumber, 15},
+		{"0b1010", TokenNumber, 10},
+		{"1_000_000", TokenNumber, 1000000},
+		{"0xFF_FF", TokenNumber, 65535},
+		{"3.141_592", TokenNumber, 3.141592},
+		{"1e1_0", TokenNumber, 1e10},
+		{"0755", TokenNumber, 755},
+		{"1e3i", TokenImag, 1000},
+		{"0x10i", TokenImag, 16},
+		{"1e400", TokenNumber, math.Inf(1)},
+		{"0x1" + strings.Repeat("0", 300), TokenNumber, math.Inf(1)},
+	}
+
+	for _, tt := range tests {
+		tokens, err := tokenize(tt.text)
+		if err != nil {
+			t.Errorf("tokenize(%q) unexpected error: %v", tt.text, err)
+			continue
+		}
+		if len(tokens) != 1 || tokens[0].Kind != tt.kind || tokens[0].Text != tt.text || tokens[0].Value != tt.value {
+			t.Errorf("tokenize(%q) = %+v, expected one token of kind %d with value %v", tt.text, tokens, tt.kind, tt.value)
+		}
+	}
+}
+
+func TestLexerErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+		pos  int
+		end  int
+	}{
+		{"1.2.3", ErrMalformedNumber, 0, 5},
+		{"2 * .", ErrMalformedNumber, 4, 5},
+		{"3 + ..", ErrMalformedNumber, 4, 6},
+		{"1e", ErrMalformedNumber, 1, 2},
+		{"2 * 1e+", ErrMalformedNumber, 5, 7},
+		{"0x", ErrMalformedNumber, 0, 2},
+		{"0b102", ErrMalformedNumber, 4, 5},
+		{"0o78", ErrMalformedNumber, 3, 4},
+		{"0xFG", ErrMalformedNumber, 3, 4},
+		{"1__000", ErrMalformedNumber, 1, 2},
+		{"1000_", ErrMalformedNumber, 4, 5},
+		{"1_.5", ErrMalformedNumber, 1, 2},
+		{"0x_FF", ErrMalformedNumber, 2, 3},
+		{"1 + 2 # 3", ErrUnknownToken, 6, 7},
+		{"3 + @", ErrUnknownToken, 4, 5},
+		{"x & y", ErrUnknownToken, 2, 3},
+		{"x | y", ErrUnknownToken, 2, 3},
+	}
+
+	for _, tt := range tests {
+		_, err := tokenize(tt.expr)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) {
+			t.Errorf("tokenize(%q) error = %v, expected *CalcError", tt.expr, err)
+			continue
+		}
+		if calcErr.Code != tt.code || calcErr.Pos != tt.pos || calcErr.End != tt.end {
+			t.Errorf("tokenize(%q) error = {code %d, [%d, %d)}, expected {code %d, [%d, %d)}",
+				tt.expr, calcErr.Code, calcErr.Pos, calcErr.End, tt.code, tt.pos, tt.end)
+		}
+	}
+}
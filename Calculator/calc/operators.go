@@ -0,0 +1,294 @@
+package calc
+
+import (
+	"fmt"
+	"math"
+	"unicode"
+)
+
+// Operator описывает оператор калькулятора: запись, приоритет, ассоциативность, число операндов и вычисление.
+type Operator struct {
+	Symbol     string // запись в выражении: "+", "<=", или слово из букв, например "mod"
+	Precedence int    // чем больше, тем сильнее связывает: у встроенных от 1 (||) до 7 (^)
+	RightAssoc bool   // группировка справа налево, как у 2^3^2 = 2^(3^2)
+	Prefix     bool   // префиксный оператор одного операнда, как унарный минус; иначе бинарный
+	// Apply вычисляет оператор в режиме float: args — один операнд префиксного оператора или два бинарного.
+	// Ошибка *CalcError (например, с кодом ErrDivisionByZero) переносится на место оператора в выражении,
+	// остальные ошибки становятся ErrDomain.
+	Apply func(args []float64) (float64, error)
+}
+
+// arity — число операндов оператора.
+func (op *Operator) arity() int {
+	if op.Prefix {
+		return 1
+	}
+	return 2
+}
+
+// OperatorSet — набор операторов, которые понимают разбор и вычисление выражения.
+// NewOperatorSet возвращает набор встроенных операторов, Register добавляет к нему свои:
+//
+//	ops := NewOperatorSet()
+//	ops.Register(Operator{Symbol: "xor", Precedence: 2, Apply: ...})
+//	env.SetOperators(ops)
+//
+// Встроенные операторы переопределить нельзя. Операторы пользователя вычисляются только в режиме float:
+// в точных и комплексных режимах у них нет реализации, и вычисление даёт ErrDomain.
+type OperatorSet struct {
+	binary map[string]*Operator
+	prefix map[string]*Operator // по записи в постфиксной записи: унарный минус — unaryMinus
+	width  int                  // длина самой длинной записи в символах, дальше лексер не заглядывает
+}
+
+// operatorAliases — другие написания встроенных операторов. Разбор сразу заменяет их основной записью.
+var operatorAliases = map[string]string{
+	"**":  "^",
+	"mod": "%",
+}
+
+// builtinOperators — встроенные операторы. Набор не меняется: свои операторы добавляются в копию из NewOperatorSet.
+var builtinOperators = NewOperatorSet()
+
+// NewOperatorSet создаёт набор встроенных операторов.
+// Степень связывает сильнее унарного минуса, как принято в математике:
+// -2^2 = -(2^2) = -4, а 2^-2 = 2^(-2) = 0.25.
+// Сравнения связывают слабее арифметики, && — слабее сравнений, || — слабее всех бинарных операторов:
+// x < 1 || x > 2 && y == 0 — это x < 1 || (x > 2 && y == 0). Ещё ниже стоит условное выражение c ? a : b,
+// оно разбирается отдельно и в набор не входит.
+// Оператор перевода единиц in (100 km/h in m/s) связывает так же слабо, как ||, и имеет смысл только в режиме units.
+//
+// Остаток % (он же mod) и целочисленное деление // связывают так же, как * и /, и согласованы между собой:
+// x == (x // y) * y + x % y. Частное округляется вниз, поэтому знак остатка совпадает со знаком делителя:
+// 7 // 2 = 3, -7 // 2 = -4, -7 % 2 = 1, 7 % -2 = -1. Деление и остаток от деления на ноль — ErrDivisionByZero.
+// Процент после числа (15%) в набор не входит: это не оператор, а сокращение, которое раскрывает разбор.
+func NewOperatorSet() *OperatorSet {
+
+	set := &OperatorSet{binary: make(map[string]*Operator), prefix: make(map[string]*Operator), width: 2}
+	binary := func(symbol string, precedence int, apply func(x, y float64) (float64, error)) {
+		set.binary[symbol] = &Operator{Symbol: symbol, Precedence: precedence, Apply: func(args []float64) (float64, error) {
+			return apply(args[0], args[1])
+		}}
+	}
+	compare := func(symbol string, cmp func(x, y float64) bool) {
+		binary(symbol, 3, func(x, y float64) (float64, error) { return boolToFloat(cmp(x, y)), nil })
+	}
+
+	// && и || вычисляются сокращённо переходами постфиксной записи, Apply нужен только для приоритета и полноты
+	binary("||", 1, func(x, y float64) (float64, error) { return boolToFloat(x != 0 || y != 0), nil })
+	binary("in", 1, func(x, y float64) (float64, error) {
+		return 0, &CalcError{Code: ErrDimension, Pos: -1, Msg: "оператор in переводит единицы измерения и работает только в режиме units"}
+	})
+	binary("&&", 2, func(x, y float64) (float64, error) { return boolToFloat(x != 0 && y != 0), nil })
+	compare("==", func(x, y float64) bool { return x == y })
+	compare("!=", func(x, y float64) bool { return x != y })
+	compare("<", func(x, y float64) bool { return x < y })
+	compare("<=", func(x, y float64) bool { return x <= y })
+	compare(">", func(x, y float64) bool { return x > y })
+	compare(">=", func(x, y float64) bool { return x >= y })
+	binary("+", 4, func(x, y float64) (float64, error) { return x + y, nil })
+	binary("-", 4, func(x, y float64) (float64, error) { return x - y, nil })
+	binary("*", 5, func(x, y float64) (float64, error) { return x * y, nil })
+	binary("/", 5, func(x, y float64) (float64, error) {
+		if y == 0 {
+			return 0, &CalcError{Code: ErrDivisionByZero, Pos: -1, Msg: "деление на ноль"}
+		}
+		return x / y, nil
+	})
+	binary("%", 5, func(x, y float64) (float64, error) {
+		if y == 0 {
+			return 0, &CalcError{Code: ErrDivisionByZero, Pos: -1, Msg: divisionByZero("%")}
+		}
+		return floorMod(x, y), nil
+	})
+	binary("//", 5, func(x, y float64) (float64, error) {
+		if y == 0 {
+			return 0, &CalcError{Code: ErrDivisionByZero, Pos: -1, Msg: divisionByZero("//")}
+		}
+		return math.Floor(x / y), nil
+	})
+	binary("^", 7, func(x, y float64) (float64, error) { return math.Pow(x, y), nil })
+	set.binary["^"].RightAssoc = true
+
+	set.prefix[unaryMinus] = &Operator{Symbol: "-", Precedence: 6, Prefix: true, Apply: func(args []float64) (float64, error) {
+		return -args[0], nil
+	}}
+	set.prefix[logicalNot] = &Operator{Symbol: logicalNot, Precedence: 6, Prefix: true, Apply: func(args []float64) (float64, error) {
+		return boolToFloat(args[0] == 0), nil
+	}}
+	return set
+}
+
+// Register добавляет оператор в набор. Запись оператора — либо слово из букв, цифр и "_", начинающееся с буквы,
+// либо последовательность знаков без скобок, запятых, "?", ":", ".", "_" и пробелов.
+// Ошибка возвращается, если запись занята другим оператором или встроенной функцией, приоритет меньше 1
+// или нет Apply. Одна запись не может быть одновременно префиксным и бинарным оператором.
+func (s *OperatorSet) Register(op Operator) error {
+
+	if err := checkOperatorSymbol(op.Symbol); err != nil {
+		return err
+	}
+	if _, ok := s.binary[op.Symbol]; ok {
+		return fmt.Errorf("оператор %s уже определён", op.Symbol)
+	}
+	if _, ok := s.prefix[postfixText(op.Symbol)]; ok || op.Symbol == toBoolean {
+		return fmt.Errorf("оператор %s уже определён", op.Symbol)
+	}
+	if _, ok := operatorAliases[op.Symbol]; ok {
+		return fmt.Errorf("оператор %s уже определён", op.Symbol)
+	}
+	if isBuiltin(op.Symbol) {
+		return fmt.Errorf("имя %s занято встроенной функцией", op.Symbol)
+	}
+	if op.Precedence < 1 {
+		return fmt.Errorf("приоритет оператора %s должен быть не меньше 1", op.Symbol)
+	}
+	if op.Apply == nil {
+		return fmt.Errorf("у оператора %s нет вычисления Apply", op.Symbol)
+	}
+
+	if op.Prefix {
+		s.prefix[op.Symbol] = &op
+	} else {
+		s.binary[op.Symbol] = &op
+	}
+	s.width = max(s.width, len([]rune(op.Symbol)))
+	return nil
+}
+
+// checkOperatorSymbol проверяет, что запись оператора лексер сможет прочитать одним токеном.
+func checkOperatorSymbol(symbol string) error {
+
+	runes := []rune(symbol)
+	if len(runes) == 0 {
+		return fmt.Errorf("пустая запись оператора")
+	}
+	if isIdentStart(runes[0]) {
+		for _, ch := range runes {
+			if !isIdentPart(ch) {
+				return fmt.Errorf("некорректная запись оператора: %s", symbol)
+			}
+		}
+		return nil
+	}
+	for _, ch := range runes {
+		if isIdentPart(ch) || unicode.IsSpace(ch) || isStructural(ch) {
+			return fmt.Errorf("некорректная запись оператора: %s", symbol)
+		}
+	}
+	if symbol == "=" {
+		return fmt.Errorf("запись = занята присваиванием")
+	}
+	return nil
+}
+
+// isStructural сообщает, является ли ch знаком, который лексер читает сам, без набора операторов.
+func isStructural(ch rune) bool {
+	switch ch {
+	case '(', ')', '[', ']', ',', '?', ':', '.':
+		return true
+	}
+	return false
+}
+
+// binaryOp возвращает бинарный оператор с записью symbol.
+func (s *OperatorSet) binaryOp(symbol string) (*Operator, bool) {
+	op, ok := s.binary[symbol]
+	return op, ok
+}
+
+// prefixOp возвращает префиксный оператор с записью symbol в исходном выражении.
+func (s *OperatorSet) prefixOp(symbol string) (*Operator, bool) {
+	op, ok := s.prefix[postfixText(symbol)]
+	return op, ok
+}
+
+// lookup находит оператор по тексту токена постфиксной записи: unaryMinus — префиксный минус, "-" — бинарный.
+func (s *OperatorSet) lookup(text string) (*Operator, bool) {
+	if op, ok := s.prefix[text]; ok {
+		return op, true
+	}
+	return s.binaryOp(text)
+}
+
+// precedence — приоритет оператора токена постфиксной записи.
+func (s *OperatorSet) precedence(text string) int {
+	op, _ := s.lookup(text)
+	if op == nil {
+		return 0
+	}
+	return op.Precedence
+}
+
+// isSymbol сообщает, является ли s записью какого-либо оператора набора, включая другие написания.
+func (s *OperatorSet) isSymbol(symbol string) bool {
+	_, binary := s.binary[symbol]
+	_, prefix := s.prefixOp(symbol)
+	_, alias := operatorAliases[symbol]
+	return binary || prefix || alias
+}
+
+// longestSymbol возвращает длину самой длинной записи оператора из знаков, с которой начинается src, или 0.
+func (s *OperatorSet) longestSymbol(src []rune) int {
+	for n := min(len(src), s.width); n > 0; n-- {
+		if !isIdentStart(src[0]) && s.isSymbol(string(src[:n])) {
+			return n
+		}
+	}
+	return 0
+}
+
+// postfixText — текст префиксного оператора в постфиксной записи: минус отличается от бинарного.
+func postfixText(symbol string) string {
+	if symbol == "-" {
+		return unaryMinus
+	}
+	return symbol
+}
+
+// isComparison сообщает, является ли op встроенным оператором сравнения.
+func isComparison(op string) bool {
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
+
+// floorMod — остаток от деления x на y со знаком делителя, в паре с делением вниз math.Floor(x / y).
+func floorMod(x, y float64) float64 {
+	r := math.Mod(x, y)
+	if r != 0 && (r < 0) != (y < 0) {
+		r += y
+	}
+	return r
+}
+
+// divisionByZero — сообщение об ошибке деления на ноль оператором op: "/", "//" или "%".
+func divisionByZero(op string) string {
+	if op == "%" {
+		return "остаток от деления на ноль"
+	}
+	return "деление на ноль"
+}
+
+// applyOperator вычисляет оператор op над args в float64; at указывает место оператора для ошибки.
+func applyOperator(at spanner, op *Operator, args ...float64) (float64, error) {
+	result, err := op.Apply(args)
+	if err == nil {
+		return result, nil
+	}
+	if inner, ok := err.(*CalcError); ok {
+		calcErr := errorAt(inner.Code, at, "%s", inner.Msg)
+		calcErr.Err = inner.Err
+		return 0, calcErr
+	}
+	calcErr := errorAt(ErrDomain, at, "%v", err)
+	calcErr.Err = err
+	return 0, calcErr
+}
+
+// unsupportedOperator — ошибка оператора пользователя в режимах, где у него нет реализации.
+func unsupportedOperator(tok Token) error {
+	return errorAt(ErrDomain, tok, "оператор %s определён только в режиме float", prefixSymbol(tok.Text))
+}
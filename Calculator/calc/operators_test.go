@@ -0,0 +1,193 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// customOperators — набор встроенных операторов с несколькими своими: словом, знаком и префиксным.
+func customOperators(t *testing.T) *OperatorSet {
+	t.Helper()
+	ops := NewOperatorSet()
+	custom := []Operator{
+		{Symbol: "xor", Precedence: 2, Apply: func(args []float64) (float64, error) {
+			return boolToFloat((args[0] != 0) != (args[1] != 0)), nil
+		}},
+		{Symbol: "<=>", Precedence: 3, Apply: func(args []float64) (float64, error) {
+			return float64(compareFloats(args[0], args[1])), nil
+		}},
+		{Symbol: "√", Precedence: 6, Prefix: true, Apply: func(args []float64) (float64, error) {
+			if args[0] < 0 {
+				return 0, errors.New("корень из отрицательного числа")
+			}
+			return math.Sqrt(args[0]), nil
+		}},
+		{Symbol: "rem", Precedence: 5, Apply: func(args []float64) (float64, error) {
+			if args[1] == 0 {
+				return 0, &CalcError{Code: ErrDivisionByZero, Pos: -1, Msg: "деление на ноль"}
+			}
+			return math.Remainder(args[0], args[1]), nil
+		}},
+		{Symbol: "^^", Precedence: 7, RightAssoc: true, Apply: func(args []float64) (float64, error) {
+			return math.Pow(args[0], math.Pow(args[1], 2)), nil
+		}},
+	}
+	for _, op := range custom {
+		if err := ops.Register(op); err != nil {
+			t.Fatalf("Register(%s) unexpected error: %v", op.Symbol, err)
+		}
+	}
+	return ops
+}
+
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func TestCustomOperators(t *testing.T) {
+	env := NewEnv()
+	env.SetOperators(customOperators(t))
+	env.Set("x", 9)
+
+	tests := []struct {
+		expr     string
+		postfix  []string
+		expected float64
+	}{
+		{"1 xor 0", []string{"1", "0", "xor"}, 1},
+		{"1 < 2 xor 2 < 3", []string{"1", "2", "<", "2", "3", "<", "xor"}, 0},
+		{"1 <=> 2", []string{"1", "2", "<=>"}, -1},
+		{"x <= 9", []string{"x", "9", "<="}, 1},
+		{"√x + 1", []string{"x", "√", "1", "+"}, 4},
+		{"-√16", []string{"16", "√", unaryMinus}, -4},
+		{"2 * 7 rem 4", []string{"2", "7", "*", "4", "rem"}, -2},
+		{"2 ^^ 1 ^^ 2", []string{"2", "1", "2", "^^", "^^"}, 2},
+	}
+
+	for _, tt := range tests {
+		_, postfix, err := parseStatement(tt.expr, env)
+		if err != nil {
+			t.Errorf("parseStatement(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(textsOf(postfix), tt.postfix) {
+			t.Errorf("parseStatement(%q) = %v, expected %v", tt.expr, textsOf(postfix), tt.postfix)
+		}
+		result, err := evaluate(tt.expr, env)
+		if err != nil || result != tt.expected {
+			t.Errorf("evaluate(%q) = %v, %v, expected %v", tt.expr, result, err, tt.expected)
+		}
+	}
+
+	// Без своего набора слово остаётся именем переменной, а знак — неизвестным токеном
+	if _, err := evaluate("1 xor 0", NewEnv()); err == nil {
+		t.Errorf("evaluate(\"1 xor 0\") with builtin operators: expected error")
+	}
+	if _, err := evaluate("√4", NewEnv()); err == nil {
+		t.Errorf("evaluate(\"√4\") with builtin operators: expected error")
+	}
+}
+
+func TestCustomOperatorErrors(t *testing.T) {
+	env := NewEnv()
+	env.SetOperators(customOperators(t))
+
+	tests := []struct {
+		expr string
+		code ErrorCode
+		pos  int
+	}{
+		{"1 + 5 rem 0", ErrDivisionByZero, 6},
+		{"2 * √-1", ErrDomain, 4},
+		{"1 xor", ErrMissingOperand, 5},
+		{"2 √3", ErrMissingOperator, 2},
+	}
+	for _, tt := range tests {
+		_, err := evaluate(tt.expr, env)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code || calcErr.Pos != tt.pos {
+			t.Errorf("evaluate(%q) error = %#v, expected %v at %d", tt.expr, err, tt.code, tt.pos)
+		}
+	}
+
+	// У операторов пользователя есть только реализация float64
+	if _, err := evaluateRat("1 xor 0", env); err == nil {
+		t.Errorf("evaluateRat(\"1 xor 0\"): expected error")
+	}
+	var calcErr *CalcError
+	if _, err := evaluateComplex("√4", env); !errors.As(err, &calcErr) || calcErr.Code != ErrDomain {
+		t.Errorf("evaluateComplex(\"√4\") error = %v, expected domain error", err)
+	}
+}
+
+func TestREPLCustomOperators(t *testing.T) {
+	env := NewEnv()
+	env.SetOperators(customOperators(t))
+	input := strings.Join([]string{
+		":tokens 1 xor √4",
+		":postfix 1 xor 2 <=> 3",
+		":tree 1 xor 0",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, env); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> Токены: [1 xor √ 4]\n",
+		"> Постфиксная запись: [1 2 3 <=> xor]\n",
+		"Ошибка: неизвестный токен: xor (позиция 3)\n",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestRegisterErrors(t *testing.T) {
+	apply := func(args []float64) (float64, error) { return 0, nil }
+	tests := []Operator{
+		{Symbol: "+", Precedence: 4, Apply: apply},
+		{Symbol: "-", Precedence: 6, Prefix: true, Apply: apply},
+		{Symbol: "!", Precedence: 2, Apply: apply},
+		{Symbol: "**", Precedence: 7, Apply: apply},
+		{Symbol: "mod", Precedence: 5, Apply: apply},
+		{Symbol: "//", Precedence: 5, Apply: apply},
+		{Symbol: "", Precedence: 1, Apply: apply},
+		{Symbol: "a+", Precedence: 1, Apply: apply},
+		{Symbol: "<(", Precedence: 1, Apply: apply},
+		{Symbol: "]", Precedence: 1, Apply: apply},
+		{Symbol: "[]", Precedence: 1, Apply: apply},
+		{Symbol: "=", Precedence: 1, Apply: apply},
+		{Symbol: "sqrt", Precedence: 6, Prefix: true, Apply: apply},
+		{Symbol: "nand", Precedence: 0, Apply: apply},
+		{Symbol: "nand", Precedence: 5},
+	}
+
+	for _, op := range tests {
+		if err := NewOperatorSet().Register(op); err == nil {
+			t.Errorf("Register(%+v): expected error", op)
+		}
+	}
+
+	// Набор из NewOperatorSet независим от встроенного
+	ops := NewOperatorSet()
+	if err := ops.Register(Operator{Symbol: "nand", Precedence: 5, Apply: apply}); err != nil {
+		t.Fatalf("Register unexpected error: %v", err)
+	}
+	if builtinOperators.isSymbol("nand") {
+		t.Errorf("Register changed the builtin operator set")
+	}
+}
@@ -0,0 +1,229 @@
+package calc
+
+import (
+	"math/big"
+	"slices"
+)
+
+// maxExactExponent ограничивает показатель степени в точном режиме:
+// числитель и знаменатель растут вместе с ним, и 10^1000000 уже считается заметное время.
+const maxExactExponent = 10000
+
+// maxExactBits ограничивает длину числителя и знаменателя в точном режиме: (9^9999)^9999 укладывается
+// в допустимый показатель, но его числитель занял бы сотни мегабит, а каждое умножение
+// удваивает длину — 2^9999 * 2^9999 * ... растёт так же быстро.
+const maxExactBits = 1 << 20
+
+// evaluatePostfixRat вычисляет постфиксную запись точно, в рациональных числах big.Rat:
+// 0.1 + 0.2 даёт ровно 3/10, а 1/3*3 — ровно 1.
+// Переменные, присвоенные в этом режиме, хранятся точно, остальные (например pi) берутся из их значения float64.
+// Доступны только операции, результат которых рационален: + - * /, степень с целым показателем, abs, min и max.
+func evaluatePostfixRat(postfix []Token, env *Env) (*big.Rat, error) {
+	return runPostfix[*big.Rat](postfix, env, ratArithmetic{})
+}
+
+// ratArithmetic — точное вычисление в big.Rat. Операции всегда создают новые значения и не меняют аргументы.
+type ratArithmetic struct{}
+
+func (ratArithmetic) number(tok Token) (*big.Rat, error) {
+	if err := realOnly(tok); err != nil {
+		return nil, err
+	}
+	// Запись уже проверил лексер: SetString отказывает, только если показатель степени слишком велик
+	r, ok := new(big.Rat).SetString(tok.Text)
+	if !ok || max(r.Num().BitLen(), r.Denom().BitLen()) > maxExactBits {
+		return nil, errorAt(ErrDomain, tok, "число %s вне диапазона точного режима: больше %d бит", tok.Text, maxExactBits)
+	}
+	return r, nil
+}
+
+func (ratArithmetic) variable(tok Token, env *Env) (*big.Rat, error) {
+	if r, ok := env.getRat(tok.Text); ok {
+		return r, nil
+	}
+	if f, ok := env.getBig(tok.Text); ok {
+		r, _ := f.Rat(nil) // значение big.Float — всегда конечная двоичная дробь
+		return r, nil
+	}
+	value, err := lookupVariable(tok, env, tok.Text)
+	if err != nil {
+		return nil, err
+	}
+	r := new(big.Rat)
+	if r.SetFloat64(value) == nil {
+		return nil, errorAt(ErrDomain, tok, "значение %s не является конечным числом", tok.Text)
+	}
+	return r, nil
+}
+
+func (ratArithmetic) prefix(tok Token, _ *Operator, x *big.Rat) (*big.Rat, error) {
+	if tok.Text != unaryMinus {
+		return nil, unsupportedOperator(tok)
+	}
+	return new(big.Rat).Neg(x), nil
+}
+
+func (a ratArithmetic) binary(tok Token, _ *Operator, left, right *big.Rat) (*big.Rat, error) {
+	result, err := a.apply(tok, left, right)
+	if err == nil && max(result.Num().BitLen(), result.Denom().BitLen()) > maxExactBits {
+		return nil, errorAt(ErrDomain, tok, "результат слишком велик для точного режима")
+	}
+	return result, err
+}
+
+func (ratArithmetic) apply(tok Token, left, right *big.Rat) (*big.Rat, error) {
+	switch tok.Text {
+	case "+":
+		return new(big.Rat).Add(left, right), nil
+	case "-":
+		return new(big.Rat).Sub(left, right), nil
+	case "*":
+		return new(big.Rat).Mul(left, right), nil
+	case "/":
+		if right.Sign() == 0 {
+			return nil, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+		}
+		return new(big.Rat).Quo(left, right), nil
+	case "%", "//":
+		if right.Sign() == 0 {
+			return nil, errorAt(ErrDivisionByZero, tok, "%s", divisionByZero(tok.Text))
+		}
+		// Частное вниз: у дроби знаменатель положителен, а big.Int.Div делит с неотрицательным остатком
+		quo := new(big.Rat).Quo(left, right)
+		floor := new(big.Rat).SetInt(new(big.Int).Div(quo.Num(), quo.Denom()))
+		if tok.Text == "//" {
+			return floor, nil
+		}
+		return new(big.Rat).Sub(left, floor.Mul(floor, right)), nil
+	case "^", "**":
+		return ratPow(tok, left, right)
+	}
+	if isComparison(tok.Text) {
+		return ratArithmetic{}.boolean(compareResult(tok.Text, left.Cmp(right))), nil
+	}
+	return nil, unsupportedOperator(tok)
+}
+
+func (ratArithmetic) truth(x *big.Rat) bool {
+	return x.Sign() != 0
+}
+
+func (ratArithmetic) boolean(b bool) *big.Rat {
+	return new(big.Rat).SetFloat64(boolToFloat(b))
+}
+
+// ratPow возводит дробь в целую степень: (a/b)^n = a^n / b^n.
+func ratPow(tok Token, base, exp *big.Rat) (*big.Rat, error) {
+	if !exp.IsInt() {
+		return nil, errorAt(ErrDomain, tok, "в точном режиме показатель степени должен быть целым")
+	}
+	n := exp.Num()
+	if n.CmpAbs(big.NewInt(maxExactExponent)) > 0 {
+		return nil, errorAt(ErrDomain, tok, "слишком большой показатель степени: %s", n)
+	}
+	// Длина a^n в битах — примерно n * длина a
+	bits := n.Int64() * int64(max(base.Num().BitLen(), base.Denom().BitLen()))
+	if bits < -maxExactBits || bits > maxExactBits {
+		return nil, errorAt(ErrDomain, tok, "результат возведения в степень слишком велик для точного режима")
+	}
+	if n.Sign() < 0 && base.Sign() == 0 {
+		return nil, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+	}
+
+	k := new(big.Int).Abs(n)
+	num := new(big.Int).Exp(base.Num(), k, nil)
+	den := new(big.Int).Exp(base.Denom(), k, nil)
+	if n.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+func (ratArithmetic) call(tok Token, args []*big.Rat) (*big.Rat, error) {
+	if err := checkCall(tok, tok.Text, len(args)); err != nil {
+		return nil, err
+	}
+
+	switch tok.Text {
+	case "abs":
+		return new(big.Rat).Abs(args[0]), nil
+	case "re", "conj":
+		return new(big.Rat).Set(args[0]), nil
+	case "im":
+		return new(big.Rat), nil
+	case "min", "max":
+		result := args[0]
+		for _, a := range args[1:] {
+			if c := a.Cmp(result); tok.Text == "min" && c < 0 || tok.Text == "max" && c > 0 {
+				result = a
+			}
+		}
+		return new(big.Rat).Set(result), nil
+	case "sum":
+		result := new(big.Rat)
+		for _, a := range args {
+			result.Add(result, a)
+		}
+		return result, nil
+	case "prod":
+		result := big.NewRat(1, 1)
+		for _, a := range args {
+			result.Mul(result, a)
+		}
+		return result, nil
+	case "avg":
+		return ratMean(args), nil
+	case "median":
+		sorted := slices.SortedFunc(slices.Values(args), (*big.Rat).Cmp)
+		n := len(sorted)
+		if n%2 == 1 {
+			return new(big.Rat).Set(sorted[n/2]), nil
+		}
+		return ratMean(sorted[n/2-1 : n/2+1]), nil
+	case "var":
+		// Выборочная дисперсия точна: в ней нет корней
+		m := ratMean(args)
+		result := new(big.Rat)
+		for _, a := range args {
+			d := new(big.Rat).Sub(a, m)
+			result.Add(result, d.Mul(d, d))
+		}
+		return result.Quo(result, big.NewRat(int64(len(args)-1), 1)), nil
+	}
+	return nil, errorAt(ErrDomain, tok, "функция %s недоступна в точном режиме", tok.Text)
+}
+
+func ratMean(args []*big.Rat) *big.Rat {
+	result := new(big.Rat)
+	for _, a := range args {
+		result.Add(result, a)
+	}
+	return result.Quo(result, big.NewRat(int64(len(args)), 1))
+}
+
+// formatRat печатает дробь: при digits < 0 — как несократимую дробь ("3/10", целые без знаменателя),
+// иначе — десятичной записью с digits знаками после запятой (последний знак округляется).
+func formatRat(r *big.Rat, digits int) string {
+	if digits >= 0 {
+		return r.FloatString(digits)
+	}
+	return r.RatString()
+}
+
+// evaluateRat вычисляет строку в точном режиме; присвоенное значение сохраняется в env без потери точности.
+func evaluateRat(line string, env *Env) (*big.Rat, error) {
+
+	name, postfix, err := parseStatement(line, env)
+	if err != nil {
+		return nil, err
+	}
+	result, err := evaluatePostfixRat(postfix, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		env.setRat(name, result)
+	}
+	return result, nil
+}
@@ -0,0 +1,160 @@
+package calc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestEvaluateRat(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"0.1 + 0.2", "3/10"},
+		{"1/3*3", "1"},
+		{"1/3 + 1/6", "1/2"},
+		{"-(2/4)", "-1/2"},
+		{"(2/3)^3", "8/27"},
+		{"(2/3)^-2", "9/4"},
+		{"2^100", "1267650600228229401496703205376"},
+		{"2^3^2", "512"},
+		{"0.125 * 8", "1"},
+		{"abs(-1/7)", "1/7"},
+		{"min(1/2, 1/3, 2/5)", "1/3"},
+		{"max(1/2, 1/3, 2/5)", "1/2"},
+		{"sum([1/2, 1/3])", "5/6"},
+		{"1e400 / 1e399", "10"},
+		{"prod([2/3, 3/4], 2)", "1"},
+		{"avg(1, 2)", "3/2"},
+		{"median(1/2, 1/3, 1/4, 1)", "5/12"},
+		{"var(1, 2, 3, 4)", "5/3"},
+		{"1.10 - 1.00", "1/10"},
+		{"1e-3 * 3", "3/1000"},
+		{"0xFF + 0b1 + 1_000", "1256"},
+		{"0.1 + 0.2 == 0.3", "1"},
+		{"1/3 < 0.3334 && !(1/3 >= 1/2)", "1"},
+		{"1/3 > 1/2 ? 1/3 : 1/2", "1/2"},
+		{"7/2 % 1", "1/2"},
+		{"-7/3 % (1/2)", "1/6"},
+		{"-7 // 2", "-4"},
+		{"0.1 mod 0.03", "1/100"},
+		{"1/3 + 50%", "1/2"},
+	}
+
+	for _, tt := range tests {
+		result, err := evaluateRat(tt.expr, nil)
+		if err != nil {
+			t.Errorf("evaluateRat(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := formatRat(result, -1); got != tt.expected {
+			t.Errorf("evaluateRat(%q) = %s, expected %s", tt.expr, got, tt.expected)
+		}
+	}
+}
+
+func TestEvaluateRatErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+	}{
+		{"1 / (1/3 - 1/3)", ErrDivisionByZero},
+		{"0^-1", ErrDivisionByZero},
+		{"2^0.5", ErrDomain},
+		{"sqrt(4)", ErrDomain},
+		{"10^100000", ErrDomain},
+		{"(9^9999)^9999", ErrDomain},
+		{"((9^9999)^9999)^9999 > 0", ErrDomain},
+		{"(1/3^5000)^-9999", ErrDomain},
+		{"(3^9999)^60 * (3^9999)^60", ErrDomain},
+		{"max()", ErrArity},
+		{"stddev(1, 2)", ErrDomain},
+		{"y + 1", ErrUndefinedVariable},
+		{"1 ? 2", ErrConditional},
+		{"1 % (1/3 - 1/3)", ErrDivisionByZero},
+		{"1 // 0", ErrDivisionByZero},
+	}
+
+	for _, tt := range tests {
+		_, err := evaluateRat(tt.expr, nil)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code {
+			t.Errorf("evaluateRat(%q) error = %v, expected code %d", tt.expr, err, tt.code)
+		}
+	}
+}
+
+// Слишком большой или слишком маленький литерал — ошибка диапазона в месте литерала, а не "некорректное число"
+func TestRatLiteralRange(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{"1e1000000000", 0},
+		{"2 * 1e-1000000000", 4},
+		{"1 + 1e400000", 4},
+		{"1e-400000", 0},
+	}
+
+	for _, tt := range tests {
+		_, err := evaluateRat(tt.expr, nil)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != ErrDomain || calcErr.Pos != tt.pos {
+			t.Errorf("evaluateRat(%q) error = %v, expected domain error at %d", tt.expr, err, tt.pos)
+		}
+	}
+}
+
+func TestFormatRat(t *testing.T) {
+	tests := []struct {
+		expr     string
+		digits   int
+		expected string
+	}{
+		{"1/3", -1, "1/3"},
+		{"1/3", 4, "0.3333"},
+		{"2/3", 4, "0.6667"},
+		{"-2/3", 2, "-0.67"},
+		{"10/4", 0, "3"},
+		{"7", 2, "7.00"},
+	}
+
+	for _, tt := range tests {
+		result, err := evaluateRat(tt.expr, nil)
+		if err != nil {
+			t.Errorf("evaluateRat(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := formatRat(result, tt.digits); got != tt.expected {
+			t.Errorf("formatRat(%q, %d) = %s, expected %s", tt.expr, tt.digits, got, tt.expected)
+		}
+	}
+}
+
+func TestRatVariablesStayExact(t *testing.T) {
+	env := NewEnv()
+	if _, err := evaluateRat("x = 1/3", env); err != nil {
+		t.Fatalf("evaluateRat unexpected error: %v", err)
+	}
+	result, err := evaluateRat("x * 3", env)
+	if err != nil {
+		t.Fatalf("evaluateRat unexpected error: %v", err)
+	}
+	if result.RatString() != "1" {
+		t.Errorf("x * 3 = %s, expected 1", result.RatString())
+	}
+
+	// В обычном режиме переменная видна как float64
+	if value, _ := env.Get("x"); value != 1.0/3 {
+		t.Errorf("float value of x = %v, expected %v", value, 1.0/3)
+	}
+
+	// Присваивание в обычном режиме заменяет точное значение
+	if _, err := evaluate("x = 0.5", env); err != nil {
+		t.Fatalf("evaluate unexpected error: %v", err)
+	}
+	result, err = evaluateRat("x", env)
+	if err != nil || result.RatString() != "1/2" {
+		t.Errorf("x = %v (%v), expected 1/2", result, err)
+	}
+}
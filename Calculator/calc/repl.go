@@ -0,0 +1,333 @@
+package calc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const replHelp = `Введите выражение (3 + 4 * 2), присваивание (x = 3.5) или определение функции (f(x, y) = x^2 + y).
+Результат последнего вычисления хранится в переменной ans.
+Сравнения == != < <= > >= и логические ! && || дают 1 или 0, условное выражение: x > 0 ? x : -x.
+Остаток 7 % 3 (или 7 mod 3), деление с округлением вниз 7 // 2, проценты: 200 + 15% = 230, 200 * 15% = 30.
+Статистика по любому числу значений: sum, prod, avg, median, var, stddev, hypot — sum(1, 2, 3) или sum([1, 2, 3]).
+Команды:
+  :tokens <выражение>   показать токены
+  :postfix <выражение>  показать постфиксную запись
+  :tree <выражение>     разобрать в дерево и напечатать обратно с минимумом скобок
+  :diff <выражение>[, <переменная>]
+                        производная выражения по переменной (по умолчанию x)
+  :simplify <выражение> упростить: вычислить константы, убрать x*1 и x+0, привести подобные
+  :vars                 показать все переменные и функции
+  :mode [float|rat|big|complex|units]
+                        показать или сменить режим: float64, точные дроби, произвольная точность,
+                        комплексные числа (i — мнимая единица, 3+4i) или величины с единицами
+                        измерения (5 m + 30 cm, 100 km/h in m/s)
+  :digits <n>           печатать n знаков после запятой, :digits auto — как обычно
+  :prec [<n>|<n>d]      точность режима big: n бит или n десятичных знаков (50d)
+  :round <режим>        округление режима big: nearest-even, nearest-away, zero, away, down, up
+  :help                 эта справка
+  :quit                 выход`
+
+// session — состояние REPL: окружение и настройки вывода.
+type session struct {
+	env    *Env
+	out    io.Writer
+	mode   Mode
+	digits int // знаков после запятой, -1 — печатать как обычно (дроби в режиме rat)
+	big    BigConfig
+}
+
+// RunREPL читает строки из in, вычисляет их в окружении env и печатает результаты в out.
+// Цикл заканчивается на команде :quit или в конце ввода. Если env равен nil, REPL работает в новом окружении
+// из NewEnv.
+func RunREPL(in io.Reader, out io.Writer, env *Env) error {
+
+	if env == nil {
+		env = NewEnv()
+	}
+	s := &session{env: env, out: out, digits: -1}
+	fmt.Fprintln(out, "Калькулятор. :help — список команд, :quit — выход.")
+	scanner := bufio.NewScanner(in)
+
+	for {
+		fmt.Fprint(out, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(out)
+			return scanner.Err()
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, ":") {
+			if quit := s.runCommand(line); quit {
+				return nil
+			}
+			continue
+		}
+
+		s.evaluate(line)
+	}
+}
+
+// evaluate вычисляет строку в текущем режиме, печатает результат и сохраняет его в ans.
+// Определение функции просто запоминается и печатается.
+func (s *session) evaluate(line string) {
+
+	fn, err := define(line, s.env)
+	if err != nil {
+		fmt.Fprintln(s.out, formatDiagnostic(line, err))
+		return
+	}
+	if fn != nil {
+		fmt.Fprintln(s.out, fn)
+		return
+	}
+
+	var text string
+	switch s.mode {
+	case ModeRat:
+		result, err := evaluateRat(line, s.env)
+		if err != nil {
+			fmt.Fprintln(s.out, formatDiagnostic(line, err))
+			return
+		}
+		s.env.setRat("ans", result)
+		text = formatRat(result, s.digits)
+
+	case ModeBig:
+		result, err := evaluateBig(line, s.env, s.big)
+		if err != nil {
+			fmt.Fprintln(s.out, formatDiagnostic(line, err))
+			return
+		}
+		s.env.setBig("ans", result.Value)
+		text = result.String()
+		if s.digits >= 0 {
+			text = result.Value.Text('f', s.digits)
+		}
+
+	case ModeComplex:
+		result, err := evaluateComplex(line, s.env)
+		if err != nil {
+			fmt.Fprintln(s.out, formatDiagnostic(line, err))
+			return
+		}
+		s.env.setComplex("ans", result)
+		text = formatComplex(result, s.digits)
+
+	case ModeUnits:
+		result, err := evaluateUnits(line, s.env)
+		if err != nil {
+			fmt.Fprintln(s.out, formatDiagnostic(line, err))
+			return
+		}
+		s.env.setQuantity("ans", result)
+		text = formatQuantity(result, s.digits)
+
+	default:
+		result, err := evaluate(line, s.env)
+		if err != nil {
+			fmt.Fprintln(s.out, formatDiagnostic(line, err))
+			return
+		}
+		s.env.Set("ans", result)
+		text = s.formatNumber(result)
+	}
+
+	fmt.Fprintln(s.out, text)
+}
+
+// postfix разбирает выражение в постфиксную запись с функциями пользователя и операторами окружения сессии.
+func (s *session) postfix(expr string) ([]Token, error) {
+	tokens, err := tokenizeWith(expr, s.env.operators())
+	if err != nil {
+		return nil, err
+	}
+	return infixToPostfixWith(tokens, s.env.resolve, s.env.operators())
+}
+
+// tree строит синтаксическое дерево выражения так же, как postfix.
+// Операторы, которых нет среди встроенных, дерево не поддерживает и сообщает о них ошибкой.
+func (s *session) tree(expr string) (Node, error) {
+	postfix, err := s.postfix(expr)
+	if err != nil {
+		return nil, err
+	}
+	return buildTree(postfix)
+}
+
+// runCommand выполняет служебную команду REPL. Возвращает true, если пора выходить.
+func (s *session) runCommand(line string) bool {
+
+	out := s.out
+	command, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch command {
+	case ":quit", ":q":
+		return true
+
+	case ":help":
+		fmt.Fprintln(out, replHelp)
+
+	case ":tokens":
+		tokens, err := tokenizeWith(arg, s.env.operators())
+		if err != nil {
+			fmt.Fprintln(out, formatDiagnostic(arg, err))
+			break
+		}
+		fmt.Fprintln(out, "Токены:", tokens)
+
+	case ":postfix":
+		postfix, err := s.postfix(arg)
+		if err != nil {
+			fmt.Fprintln(out, formatDiagnostic(arg, err))
+			break
+		}
+		fmt.Fprintln(out, "Постфиксная запись:", postfix)
+
+	case ":tree":
+		tree, err := s.tree(arg)
+		if err != nil {
+			fmt.Fprintln(out, formatDiagnostic(arg, err))
+			break
+		}
+		fmt.Fprintln(out, "Дерево:", Format(tree))
+
+	case ":diff":
+		expr, x := splitDiffArg(arg)
+		tree, err := s.tree(expr)
+		if err == nil {
+			tree, err = Derivative(tree, x)
+		}
+		if err != nil {
+			fmt.Fprintln(out, formatDiagnostic(expr, err))
+			break
+		}
+		tree, _ = Simplify(tree)
+		fmt.Fprintln(out, "Производная:", Format(tree))
+
+	case ":simplify":
+		tree, err := s.tree(arg)
+		if err != nil {
+			fmt.Fprintln(out, formatDiagnostic(arg, err))
+			break
+		}
+		if simplified, changed := Simplify(tree); changed {
+			fmt.Fprintln(out, "Упрощено:", Format(simplified))
+		} else {
+			fmt.Fprintln(out, "Упрощать нечего:", Format(tree))
+		}
+
+	case ":vars":
+		for _, name := range s.env.Names() {
+			value, _ := s.env.Get(name)
+			text := s.formatNumber(value)
+			if exact, ok := s.env.getRat(name); ok {
+				text = formatRat(exact, s.digits)
+			}
+			if precise, ok := s.env.getBig(name); ok {
+				_, digits := s.big.resolve()
+				text = precise.Text('g', digits)
+			}
+			if z, ok := s.env.getComplex(name); ok {
+				text = formatComplex(z, s.digits)
+			}
+			if q, ok := s.env.getQuantity(name); ok {
+				text = formatQuantity(q, s.digits)
+			}
+			fmt.Fprintf(out, "%s = %s\n", name, text)
+		}
+		for _, name := range s.env.FunctionNames() {
+			fn, _ := s.env.userFunction(name)
+			fmt.Fprintln(out, fn)
+		}
+
+	case ":mode":
+		if arg != "" {
+			mode, err := ParseMode(arg)
+			if err != nil {
+				fmt.Fprintln(out, "Ошибка:", err)
+				break
+			}
+			s.mode = mode
+		}
+		fmt.Fprintln(out, "Режим:", s.mode)
+
+	case ":prec":
+		if arg != "" {
+			digits, isDigits := strings.CutSuffix(arg, "d")
+			n, err := strconv.Atoi(digits)
+			if err != nil || n <= 0 {
+				fmt.Fprintln(out, "Ошибка: ожидалось положительное число бит или знаков (например 256 или 50d)")
+				break
+			}
+			if isDigits {
+				s.big.Prec, s.big.Digits = 0, n
+			} else {
+				s.big.Prec, s.big.Digits = uint(n), 0
+			}
+		}
+		prec, digits := s.big.resolve()
+		fmt.Fprintf(out, "Точность: %d бит (%d знаков), округление %s\n", prec, digits, roundingName(s.big.Rounding))
+
+	case ":round":
+		mode, err := parseRounding(arg)
+		if err != nil {
+			fmt.Fprintln(out, "Ошибка:", err)
+			break
+		}
+		s.big.Rounding = mode
+
+	case ":digits":
+		if arg == "auto" {
+			s.digits = -1
+			break
+		}
+		digits, err := strconv.Atoi(arg)
+		if err != nil || digits < 0 {
+			fmt.Fprintln(out, "Ошибка: ожидалось неотрицательное число знаков или auto")
+			break
+		}
+		s.digits = digits
+
+	default:
+		fmt.Fprintf(out, "Неизвестная команда %s, список команд — :help\n", command)
+	}
+	return false
+}
+
+// splitDiffArg отделяет от аргумента :diff имя переменной после последней запятой.
+// Если после запятой не имя (как в ":diff max(x, y)"), весь аргумент — выражение, а переменная — x.
+func splitDiffArg(arg string) (string, string) {
+	i := strings.LastIndex(arg, ",")
+	if i < 0 {
+		return arg, "x"
+	}
+	name := strings.TrimSpace(arg[i+1:])
+	tokens, err := tokenize(name)
+	if err != nil || len(tokens) != 1 || tokens[0].Kind != TokenIdent {
+		return arg, "x"
+	}
+	return strings.TrimSpace(arg[:i]), name
+}
+
+// formatNumber печатает число с заданным числом знаков после запятой,
+// а по умолчанию — без лишних нулей, отбрасывая шум последних разрядов float64.
+func (s *session) formatNumber(value float64) string {
+	if s.digits >= 0 {
+		return strconv.FormatFloat(value, 'f', s.digits, 64)
+	}
+	return formatNumber(value)
+}
+
+// formatNumber печатает число без лишних нулей, отбрасывая шум последних разрядов float64.
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'g', 15, 64)
+}
@@ -0,0 +1,154 @@
+package calc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestREPL(t *testing.T) {
+	input := strings.Join([]string{
+		"3 + (4 * 2 - ( 3 * 4 - 2) / 2) - 7 / 2",
+		"ans * 2",
+		"",
+		"x = 0.1 + 0.2",
+		":tokens 2*x",
+		":postfix -(1 + 2) * x",
+		":postfix (1",
+		":tree ((1 + 2)) * -(x)",
+		"1 / 0",
+		"ans + 1",
+		":vars",
+		":frobnicate",
+		":quit",
+		"999",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, NewEnv()); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> 2.5\n",
+		"> 5\n",
+		"> > 0.3\n",
+		"> Токены: [2 * x]\n",
+		"> Постфиксная запись: [1 2 + u- x *]\n",
+		"> Дерево: (1 + 2) * -x\n",
+		"> (1\n^\nОшибка: не совпадают скобки (позиция 1)\n",
+		"> 1 / 0\n  ^\nОшибка: деление на ноль (позиция 3)\n",
+		"> 1.3\n",
+		"> ans = 1.3\ne = 2.71828182845905\npi = 3.14159265358979\nx = 0.3\n",
+		"> Неизвестная команда :frobnicate",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "999") {
+		t.Errorf("REPL kept reading after :quit:\n%s", got)
+	}
+}
+
+func TestREPLEndOfInput(t *testing.T) {
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader("2^10"), &out, NewEnv()); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "> 1024\n") {
+		t.Errorf("REPL output = %q, expected result 1024", out.String())
+	}
+}
+
+func TestREPLNilEnv(t *testing.T) {
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader("x = 2 * pi\nans / x\nf(t) = t^2\nf(3)"), &out, nil); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+	for _, want := range []string{"> 6.28318530717959\n", "> 1\n", "> 9\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("REPL output = %q, expected %q", out.String(), want)
+		}
+	}
+}
+
+func TestREPLModes(t *testing.T) {
+	input := strings.Join([]string{
+		"0.1 + 0.2",
+		":mode rat",
+		"0.1 + 0.2",
+		"ans * 10",
+		"x = 1/3",
+		":vars",
+		":digits 3",
+		"x",
+		":mode float",
+		"x",
+		":mode quaternion",
+		":digits -2",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, &Env{}); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> 0.3\n",
+		"> Режим: rat\n",
+		"> 3/10\n",
+		"> 3\n",
+		"> 1/3\n",
+		"> ans = 1/3\nx = 1/3\n",
+		"> 0.333\n",
+		"> Режим: float\n",
+		"> Ошибка: неизвестный режим \"quaternion\"",
+		"> Ошибка: ожидалось неотрицательное число знаков",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestREPLBigMode(t *testing.T) {
+	input := strings.Join([]string{
+		":mode big",
+		":prec 30d",
+		"x = 1/7",
+		"x * 7",
+		":prec 64",
+		":round zero",
+		":prec",
+		":digits 5",
+		"pi",
+		":prec 0",
+		":round sideways",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, NewEnv()); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> Режим: big\n",
+		"> Точность: 104 бит (30 знаков), округление nearest-even\n",
+		"> 0.142857142857142857142857142857\n",
+		"> 1\n",
+		"> Точность: 64 бит (19 знаков), округление zero\n",
+		"> 3.14159\n",
+		"> Ошибка: ожидалось положительное число бит или знаков",
+		"> Ошибка: неизвестный режим округления",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package calc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// maxRequestBytes ограничивает размер тела запроса к серверу.
+const maxRequestBytes = 1 << 20
+
+// EvalTimeout — сколько сервер ждёт ответа обработчика; не дождавшись, он отвечает 503 с кодом "timeout".
+// Само вычисление при этом не прерывается и идёт до конца: время его ограничивают только serverLimits,
+// доступные на сервере режимы float и rat и предел размера чисел режима rat.
+const EvalTimeout = 10 * time.Second
+
+// serverLimits — ограничения выражений, которые принимает сервер.
+var serverLimits = Limits{MaxLength: 4096, MaxDepth: 64}
+
+// evalRequest — тело запросов к серверу. Для /tokens и /postfix нужно только выражение.
+type evalRequest struct {
+	Expr string             `json:"expr"`
+	Vars map[string]float64 `json:"vars,omitempty"`
+	Mode string             `json:"mode,omitempty"` // float (по умолчанию) или rat
+}
+
+// evalResponse — результат /eval: Result напечатан так же, как в REPL соответствующего режима
+// ("3/10" в режиме rat), Value — его приближение float64. У NaN и бесконечности (sqrt(-1), 1e308*10)
+// Value нет: в JSON их не записать, Result — "NaN" или "+Inf".
+type evalResponse struct {
+	Result string   `json:"result"`
+	Value  *float64 `json:"value,omitempty"`
+}
+
+type tokenJSON struct {
+	Kind  string   `json:"kind"`
+	Text  string   `json:"text"`
+	Value *float64 `json:"value,omitempty"`
+	Argc  *int     `json:"argc,omitempty"`
+	Pos   int      `json:"pos"`
+	End   int      `json:"end"`
+}
+
+// errorJSON — ошибка в ответе сервера и в выводе RunBatch. Code — имя ErrorCode ("division-by-zero"),
+// Pos и End — номера символов выражения, как в CalcError; у ошибок без места их нет.
+type errorJSON struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Pos     *int   `json:"pos,omitempty"`
+	End     *int   `json:"end,omitempty"`
+}
+
+// NewServer возвращает обработчик HTTP-сервера калькулятора:
+//
+//	POST /eval     {"expr": "x^2 + 1", "vars": {"x": 3}, "mode": "float"} → {"result": "10", "value": 10}
+//	POST /tokens   {"expr": "3+4"} → {"tokens": [{"kind": "number", "text": "3", ...}, ...]}
+//	POST /postfix  {"expr": "3+4"} → {"postfix": ["3", "4", "+"]}
+//
+// Ошибки разбора и вычисления возвращаются со статусом 422 в виде {"error": {...}} с местом ошибки в выражении.
+// Выражения ограничены serverLimits, время ответа — EvalTimeout.
+func NewServer() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /eval", handleEval)
+	mux.HandleFunc("POST /tokens", handleTokens)
+	mux.HandleFunc("POST /postfix", handlePostfix)
+
+	timeout, _ := json.Marshal(map[string]errorJSON{"error": {Code: "timeout", Message: "вычисление не уложилось в отведённое время"}})
+	return http.TimeoutHandler(mux, EvalTimeout, string(timeout))
+}
+
+func handleEval(w http.ResponseWriter, r *http.Request) {
+
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+	mode := ModeFloat
+	if req.Mode != "" {
+		var err error
+		if mode, err = ParseMode(req.Mode); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if mode != ModeFloat && mode != ModeRat {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("режим %s недоступен на сервере, доступны: float, rat", mode))
+		return
+	}
+
+	result, err := Evaluate(req.Expr, &Options{Mode: mode, Vars: req.Vars, Limits: serverLimits})
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, evalResponse{Result: result.Text, Value: finiteValue(result)})
+}
+
+// finiteValue возвращает приближение float64 результата, если оно есть и конечно.
+func finiteValue(r Result) *float64 {
+	if !r.HasValue || math.IsNaN(r.Value) || math.IsInf(r.Value, 0) {
+		return nil
+	}
+	return &r.Value
+}
+
+func handleTokens(w http.ResponseWriter, r *http.Request) {
+
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := tokenizeLimited(req.Expr)
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tokens": tokensJSON(tokens)})
+}
+
+func handlePostfix(w http.ResponseWriter, r *http.Request) {
+
+	req, ok := decodeRequest(w, r)
+	if !ok {
+		return
+	}
+	tokens, err := tokenizeLimited(req.Expr)
+	var postfix []Token
+	if err == nil {
+		postfix, err = infixToPostfix(tokens)
+	}
+	if err != nil {
+		writeError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	texts := make([]string, len(postfix))
+	for i, token := range postfix {
+		texts[i] = token.String()
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"postfix": texts, "tokens": tokensJSON(postfix)})
+}
+
+// tokenizeLimited разбирает выражение на токены, проверяя serverLimits.
+func tokenizeLimited(expr string) ([]Token, error) {
+	if err := serverLimits.check(expr, nil); err != nil {
+		return nil, err
+	}
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return tokens, serverLimits.check(expr, tokens)
+}
+
+// decodeRequest читает тело запроса; при ошибке сам отвечает клиенту и возвращает false.
+func decodeRequest(w http.ResponseWriter, r *http.Request) (evalRequest, bool) {
+	var req evalRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("некорректный JSON: %w", err))
+		return req, false
+	}
+	return req, true
+}
+
+func tokensJSON(tokens []Token) []tokenJSON {
+	result := make([]tokenJSON, len(tokens))
+	for i, token := range tokens {
+		result[i] = tokenJSON{Kind: token.Kind.String(), Text: token.Text, Pos: token.Pos, End: token.End}
+		switch token.Kind {
+		case TokenNumber, TokenImag:
+			if !math.IsInf(token.Value, 0) {
+				result[i].Value = &token.Value
+			}
+		case TokenCall, TokenJumpIfFalse, TokenJump:
+			result[i].Argc = &token.Argc
+		}
+	}
+	return result
+}
+
+// writeError отвечает ошибкой в виде {"error": {...}}.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]errorJSON{"error": newErrorJSON(err)})
+}
+
+// newErrorJSON переводит ошибку в errorJSON: *CalcError — с кодом и местом, остальные — как "bad-request".
+func newErrorJSON(err error) errorJSON {
+	var calcErr *CalcError
+	if !errors.As(err, &calcErr) {
+		return errorJSON{Code: "bad-request", Message: err.Error()}
+	}
+	body := errorJSON{Code: calcErr.Code.String(), Message: calcErr.Msg}
+	if calcErr.Pos >= 0 {
+		body.Pos, body.End = &calcErr.Pos, &calcErr.End
+	}
+	return body
+}
+
+// writeJSON отвечает телом body. Тело кодируется до записи заголовка, чтобы ошибку кодирования
+// можно было вернуть статусом 500, а не пустым ответом 200.
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data, _ = json.Marshal(map[string]errorJSON{"error": {Code: "internal", Message: err.Error()}})
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,121 @@
+package calc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// post отправляет запрос тестовому серверу и разбирает JSON-ответ.
+func post(t *testing.T, server *httptest.Server, path, body string) (int, map[string]any) {
+	t.Helper()
+	resp, err := http.Post(server.URL+path, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+	var result map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("POST %s: decoding response: %v", path, err)
+	}
+	return resp.StatusCode, result
+}
+
+func TestServerEval(t *testing.T) {
+	server := httptest.NewServer(NewServer())
+	defer server.Close()
+
+	tests := []struct {
+		body   string
+		result string
+		value  any
+	}{
+		{`{"expr": "3 + 4 * 2"}`, "11", 11.0},
+		{`{"expr": "x^2 + y", "vars": {"x": 3, "y": 0.5}}`, "9.5", 9.5},
+		{`{"expr": "0.1 + 0.2", "mode": "rat"}`, "3/10", 0.3},
+		{`{"expr": "1/3 + 1/6", "mode": "rat"}`, "1/2", 0.5},
+		{`{"expr": "pi * r^2", "vars": {"r": 1}, "mode": "float"}`, "3.14159265358979", 3.141592653589793},
+		{`{"expr": "sqrt(-1)"}`, "NaN", nil},
+		{`{"expr": "1e308*10"}`, "+Inf", nil},
+	}
+
+	for _, tt := range tests {
+		status, resp := post(t, server, "/eval", tt.body)
+		if status != http.StatusOK || resp["result"] != tt.result || resp["value"] != tt.value {
+			t.Errorf("POST /eval %s = %d %v, expected result %q and value %v", tt.body, status, resp, tt.result, tt.value)
+		}
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	server := httptest.NewServer(NewServer())
+	defer server.Close()
+
+	tests := []struct {
+		path   string
+		body   string
+		status int
+		code   string
+		pos    any
+	}{
+		{"/eval", `{"expr": "1 / (x - 2)", "vars": {"x": 2}}`, 422, "division-by-zero", 2.0},
+		{"/eval", `{"expr": "3 + (4 * 2"}`, 422, "mismatched-paren", 4.0},
+		{"/eval", `{"expr": "y + 1"}`, 422, "undefined-variable", 0.0},
+		{"/eval", `{"expr": "1", "mode": "octal"}`, 400, "bad-request", nil},
+		{"/eval", `{"expr": "2^2000", "mode": "big"}`, 400, "bad-request", nil},
+		{"/eval", `{"expr": "sqrt(-4)", "mode": "complex"}`, 400, "bad-request", nil},
+		{"/eval", `{"expr": "5 m + 3 s", "mode": "units"}`, 400, "bad-request", nil},
+		{"/eval", `{"expr": 1}`, 400, "bad-request", nil},
+		{"/eval", `{"expression": "1"}`, 400, "bad-request", nil},
+		{"/tokens", `{"expr": "2 # 3"}`, 422, "unknown-token", 2.0},
+		{"/postfix", `{"expr": "max(1,"}`, 422, "missing-operand", 6.0},
+		{"/eval", `{"expr": "1` + strings.Repeat(" + 1", 1200) + `"}`, 422, "limit", 4096.0},
+		{"/eval", `{"expr": "` + strings.Repeat("(", 65) + `1` + strings.Repeat(")", 65) + `"}`, 422, "limit", 64.0},
+		{"/tokens", `{"expr": "` + strings.Repeat("-", 5000) + `1"}`, 422, "limit", 4096.0},
+		{"/postfix", `{"expr": "` + strings.Repeat("sin(", 100) + `1` + strings.Repeat(")", 100) + `"}`, 422, "limit", 259.0},
+		{"/eval", `{"expr": "(3^9999)^60 * (3^9999)^60", "mode": "rat"}`, 422, "domain", 12.0},
+	}
+
+	for _, tt := range tests {
+		status, resp := post(t, server, tt.path, tt.body)
+		errBody, _ := resp["error"].(map[string]any)
+		if status != tt.status || errBody["code"] != tt.code || errBody["pos"] != tt.pos || errBody["message"] == "" {
+			t.Errorf("POST %s %s = %d %v, expected %d with code %s at %v", tt.path, tt.body, status, resp, tt.status, tt.code, tt.pos)
+		}
+	}
+}
+
+func TestServerTokensAndPostfix(t *testing.T) {
+	server := httptest.NewServer(NewServer())
+	defer server.Close()
+
+	_, resp := post(t, server, "/tokens", `{"expr": "max(x, 2)"}`)
+	tokens, _ := resp["tokens"].([]any)
+	if len(tokens) != 6 {
+		t.Fatalf("POST /tokens = %v, expected 6 tokens", resp)
+	}
+	first, _ := tokens[0].(map[string]any)
+	number, _ := tokens[4].(map[string]any)
+	if first["kind"] != "ident" || first["text"] != "max" || first["pos"] != 0.0 || first["end"] != 3.0 {
+		t.Errorf("first token = %v, expected ident max at [0, 3)", first)
+	}
+	if number["kind"] != "number" || number["value"] != 2.0 {
+		t.Errorf("fifth token = %v, expected number 2", number)
+	}
+
+	_, resp = post(t, server, "/postfix", `{"expr": "-2 ^ 2 + max(1, 3)"}`)
+	postfix, _ := json.Marshal(resp["postfix"])
+	if string(postfix) != `["2","2","^","u-","1","3","max(2)","+"]` {
+		t.Errorf("POST /postfix = %s, expected [2 2 ^ u- 1 3 max(2) +]", postfix)
+	}
+}
+
+func TestServerMethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/eval", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /eval status = %d, expected %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,394 @@
+package calc
+
+import (
+	"math"
+	"slices"
+)
+
+// maxSimplifyPasses ограничивает число проходов упрощения. Обычно хватает двух: второй лишь подтверждает,
+// что упрощать больше нечего.
+const maxSimplifyPasses = 10
+
+// Simplify упрощает дерево со свободными переменными и сообщает, изменилось ли что-нибудь:
+//   - вычисляет подвыражения без переменных: 2 * 3 + x → 6 + x, sqrt(16) → 4; вызов функции заменяется
+//     значением, только если оно целое, а ln(2) и sqrt(2) остаются точной записью;
+//   - убирает тождества: x * 1, x + 0, x^1, x / 1, 0 * x;
+//   - приводит подобные слагаемые и множители: 2*x + y + 3*x → 5 * x + y, x * x^2 → x^3;
+//   - выбирает ветку условного выражения с известным условием: 1 > 0 ? x : y → x.
+//
+// Константа суммы ставится в конец, числовой множитель — в начало произведения.
+// Подвыражения, вычисление которых даёт ошибку (деление на ноль, sqrt(-1)), остаются как есть,
+// чтобы ошибка проявилась при вычислении; остаются и константы, которые свернулись бы в NaN или бесконечность
+// (1e308 * 10): их не записать так, чтобы ParseTree прочитал запись обратно. По той же причине умножение на ноль и взаимное уничтожение
+// подобных слагаемых и множителей убирают подвыражение, только если оно определено при любых значениях
+// переменных (см. defined): 0 * (1 / x) и x / x остаются. Если упрощать нечего, возвращается исходное дерево.
+func Simplify(n Node) (Node, bool) {
+
+	before := Format(n)
+	result, text := n, before
+	for i := 0; i < maxSimplifyPasses; i++ {
+		next := simplifyNode(result)
+		nextText := Format(next)
+		if nextText == text {
+			break
+		}
+		result, text = next, nextText
+	}
+
+	if text == before {
+		return n, false
+	}
+	return result, true
+}
+
+// simplifyNode выполняет один проход упрощения снизу вверх.
+func simplifyNode(n Node) Node {
+
+	switch n := n.(type) {
+	case *UnaryNode:
+		x := simplifyNode(n.X)
+		if n.Op == logicalNot {
+			if number, ok := x.(*NumberNode); ok && !number.Imag {
+				return num(boolToFloat(number.Value == 0))
+			}
+			return &UnaryNode{Span: n.Span, Op: n.Op, X: x}
+		}
+		return collectSum(neg(x))
+
+	case *CondNode:
+		cond := simplifyNode(n.Cond)
+		if number, ok := cond.(*NumberNode); ok && !number.Imag {
+			if number.Value != 0 {
+				return simplifyNode(n.Then)
+			}
+			return simplifyNode(n.Else)
+		}
+		return &CondNode{Span: n.Span, Cond: cond, Then: simplifyNode(n.Then), Else: simplifyNode(n.Else)}
+
+	case *BinaryNode:
+		left, right := simplifyNode(n.Left), simplifyNode(n.Right)
+		switch n.Op {
+		case "&&", "||":
+			// Известная левая часть либо решает всё сама, либо оставляет только правую
+			if number, ok := left.(*NumberNode); ok && !number.Imag && (number.Value == 0) == (n.Op == "&&") {
+				return num(boolToFloat(number.Value != 0))
+			}
+			if x, y, ok := numbers(left, right); ok {
+				return num(boolToFloat(y != 0 && (n.Op == "||" || x != 0)))
+			}
+			return &BinaryNode{Span: n.Span, Op: n.Op, Left: left, Right: right}
+		case "+", "-":
+			return collectSum(&BinaryNode{Span: n.Span, Op: n.Op, Left: left, Right: right})
+		case "*":
+			if isNumber(left, 0) && !defined(right) || isNumber(right, 0) && !defined(left) {
+				return &BinaryNode{Span: n.Span, Op: n.Op, Left: left, Right: right}
+			}
+			return collectProduct(&BinaryNode{Span: n.Span, Op: n.Op, Left: left, Right: right})
+		case "/":
+			// 0 / x и x / x не равны 0 и 1 при x = 0, поэтому сокращается только деление на число
+			if x, y, ok := numbers(left, right); ok && y != 0 && finite(x/y) {
+				return num(x / y)
+			}
+			if isNumber(right, 1) {
+				return left
+			}
+			return &BinaryNode{Span: n.Span, Op: n.Op, Left: left, Right: right}
+		case "^":
+			if x, y, ok := numbers(left, right); ok {
+				if value := math.Pow(x, y); finite(value) {
+					return num(value)
+				}
+			}
+			if isNumber(right, 0) && !defined(left) {
+				return &BinaryNode{Span: n.Span, Op: n.Op, Left: left, Right: right}
+			}
+			return pow(left, right)
+		}
+		if isComparison(n.Op) || n.Op == "%" || n.Op == "//" {
+			if x, y, ok := numbers(left, right); ok {
+				op, _ := builtinOperators.binaryOp(n.Op)
+				if value, err := applyOperator(n, op, x, y); err == nil && finite(value) {
+					return num(value)
+				}
+			}
+			return &BinaryNode{Span: n.Span, Op: n.Op, Left: left, Right: right}
+		}
+
+	case *CallNode:
+		args := make([]Node, len(n.Args))
+		values := make([]float64, len(n.Args))
+		constant := true
+		for i, arg := range n.Args {
+			args[i] = simplifyNode(arg)
+			number, ok := args[i].(*NumberNode)
+			constant = constant && ok && !number.Imag
+			if constant {
+				values[i] = number.Value
+			}
+		}
+		if constant {
+			value, err := callFunction(n, n.Name, values)
+			if err == nil && finite(value) && value == math.Trunc(value) {
+				return num(value)
+			}
+		}
+		return &CallNode{Span: n.Span, Name: n.Name, Args: args}
+	}
+
+	return n
+}
+
+// term — слагаемое суммы: числовой коэффициент при одночлене.
+type term struct {
+	coef float64
+	node Node
+	key  string // запись одночлена, по ней находятся подобные слагаемые
+}
+
+// collectSum приводит подобные слагаемые суммы, раскрывая вложенные + и - и унарные минусы.
+func collectSum(n Node) Node {
+
+	if !isSum(n) {
+		return n
+	}
+
+	var terms []term
+	constant := 0.0
+
+	var collect func(n Node, sign float64)
+	collect = func(n Node, sign float64) {
+		switch n := n.(type) {
+		case *BinaryNode:
+			if n.Op == "+" || n.Op == "-" {
+				collect(n.Left, sign)
+				if n.Op == "-" {
+					sign = -sign
+				}
+				collect(n.Right, sign)
+				return
+			}
+		case *UnaryNode:
+			if n.Op == "-" {
+				collect(n.X, -sign)
+				return
+			}
+		case *NumberNode:
+			if !n.Imag {
+				constant += sign * n.Value
+				return
+			}
+		}
+
+		coef, node := splitCoefficient(n)
+		if number, ok := node.(*NumberNode); ok && !number.Imag {
+			constant += sign * coef * number.Value // произведение чисел, которое collectProduct не свернул
+			return
+		}
+		key := Format(node)
+		for i := range terms {
+			if terms[i].key == key {
+				terms[i].coef += sign * coef
+				return
+			}
+		}
+		terms = append(terms, term{coef: sign * coef, node: node, key: key})
+	}
+	collect(n, 1)
+
+	if !finite(constant) || slices.ContainsFunc(terms, func(t term) bool { return !finite(t.coef) }) {
+		return n
+	}
+	var result Node
+	for _, t := range terms {
+		if t.coef == 0 && !defined(t.node) {
+			// 1/x - 1/x — не ноль при x = 0: оставляем 0 * (1 / x), чтобы ошибка не пропала
+			t.coef, t.node = 1, &BinaryNode{Op: "*", Left: num(0), Right: t.node}
+		}
+		switch {
+		case t.coef == 0:
+		case result == nil:
+			result = scale(t.coef, t.node)
+		case t.coef < 0:
+			result = sub(result, scale(-t.coef, t.node))
+		default:
+			result = add(result, scale(t.coef, t.node))
+		}
+	}
+	switch {
+	case result == nil:
+		return num(constant)
+	case constant < 0:
+		return sub(result, num(-constant))
+	}
+	return add(result, num(constant))
+}
+
+// isSum сообщает, есть ли в n сумма или разность, которую collectSum может раскрыть.
+func isSum(n Node) bool {
+	switch n := n.(type) {
+	case *BinaryNode:
+		return n.Op == "+" || n.Op == "-"
+	case *UnaryNode:
+		return n.Op == "-" && isSum(n.X)
+	}
+	return false
+}
+
+// splitCoefficient отделяет числовой множитель в начале произведения: 2 * a * x → 2 и a * x.
+func splitCoefficient(n Node) (float64, Node) {
+	product, ok := n.(*BinaryNode)
+	if !ok || product.Op != "*" {
+		return 1, n
+	}
+	if number, ok := product.Left.(*NumberNode); ok && !number.Imag {
+		return number.Value, product.Right
+	}
+	coef, rest := splitCoefficient(product.Left)
+	if coef == 1 {
+		return 1, n
+	}
+	return coef, &BinaryNode{Op: "*", Left: rest, Right: product.Right}
+}
+
+// scale умножает одночлен на число, ставя его в начало произведения: scale(2, a * x) → 2 * a * x,
+// scale(-1, a * x) → -a * x.
+func scale(coef float64, n Node) Node {
+	if product, ok := n.(*BinaryNode); ok && product.Op == "*" && coef != 1 && coef != 0 {
+		return &BinaryNode{Op: "*", Left: scale(coef, product.Left), Right: product.Right}
+	}
+	return mul(num(coef), n)
+}
+
+// factor — множитель произведения: основание в степени.
+type factor struct {
+	base    Node
+	exp     Node
+	key     string // запись основания, по ней находятся множители с одинаковым основанием
+	defined bool   // множитель определён при любых значениях переменных, см. defined
+}
+
+// collectProduct собирает числовые множители в один коэффициент и складывает степени одинаковых оснований.
+// Степени складываются только у определённых везде множителей: x * x^-1 не равно 1 при x = 0.
+func collectProduct(n Node) Node {
+
+	if product, ok := n.(*BinaryNode); !ok || product.Op != "*" {
+		return n
+	}
+
+	var factors []factor
+	coef := 1.0
+
+	var collect func(n Node)
+	collect = func(n Node) {
+		switch n := n.(type) {
+		case *BinaryNode:
+			if n.Op == "*" {
+				collect(n.Left)
+				collect(n.Right)
+				return
+			}
+		case *UnaryNode:
+			if n.Op == "-" {
+				coef = -coef
+				collect(n.X)
+				return
+			}
+		case *NumberNode:
+			if !n.Imag {
+				coef *= n.Value
+				return
+			}
+		}
+
+		base, exp := n, num(1)
+		if power, ok := n.(*BinaryNode); ok && power.Op == "^" {
+			base, exp = power.Left, power.Right
+		}
+		key, total := Format(base), defined(n)
+		for i := range factors {
+			if factors[i].key == key && factors[i].defined && total {
+				factors[i].exp = add(factors[i].exp, exp)
+				return
+			}
+		}
+		factors = append(factors, factor{base: base, exp: exp, key: key, defined: total})
+	}
+	collect(n)
+
+	if !finite(coef) {
+		return n
+	}
+	if coef == 0 {
+		for _, f := range factors {
+			if !f.defined {
+				return n
+			}
+		}
+		return num(0)
+	}
+	var result Node
+	for _, f := range factors {
+		p := pow(f.base, f.exp)
+		switch {
+		case isNumber(p, 1):
+		case result == nil:
+			result = p
+		default:
+			result = mul(result, p)
+		}
+	}
+	if result == nil {
+		return num(coef)
+	}
+	return scale(coef, result)
+}
+
+// finite сообщает, что v — конечное число. Свёртка констант, давшая NaN или бесконечность, не выполняется:
+// такое число не записать в выражении, которое снова разберёт ParseTree.
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// partialFunctions — встроенные функции, которые определены не при всех значениях аргумента.
+var partialFunctions = map[string]bool{"sqrt": true, "ln": true, "log": true}
+
+// defined сообщает, что выражение вычисляется без ошибки и без NaN при любых конечных значениях переменных.
+// Проверка консервативная: деление на не-число, степень с нецелым или отрицательным показателем
+// и вызовы partialFunctions считаются неопределёнными всегда.
+func defined(n Node) bool {
+
+	switch n := n.(type) {
+	case *NumberNode:
+		return !n.Imag
+	case *VarNode:
+		return true
+	case *UnaryNode:
+		return defined(n.X)
+	case *CondNode:
+		return defined(n.Cond) && defined(n.Then) && defined(n.Else)
+	case *BinaryNode:
+		if !defined(n.Left) || !defined(n.Right) {
+			return false
+		}
+		switch n.Op {
+		case "/", "%", "//":
+			number, ok := n.Right.(*NumberNode)
+			return ok && number.Value != 0
+		case "^":
+			number, ok := n.Right.(*NumberNode)
+			return ok && number.Value >= 0 && number.Value == math.Trunc(number.Value)
+		}
+		return true
+	case *CallNode:
+		if partialFunctions[n.Name] {
+			return false
+		}
+		for _, arg := range n.Args {
+			if !defined(arg) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
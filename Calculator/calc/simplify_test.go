@@ -0,0 +1,139 @@
+package calc
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSimplify(t *testing.T) {
+	huge := "1" + strings.Repeat("0", 308) // так Format печатает 1e308
+	tests := []struct {
+		expr     string
+		expected string
+		changed  bool
+	}{
+		{"2 * 3 + x", "x + 6", true},
+		{"x * 1", "x", true},
+		{"x + 0", "x", true},
+		{"x^1", "x", true},
+		{"x / 1", "x", true},
+		{"(x + y) / (x + y)", "(x + y) / (x + y)", false},
+		{"x / x", "x / x", false},
+		{"0 / x", "0 / x", false},
+		{"0 * (1 / 0)", "0 * (1 / 0)", false},
+		{"0 * sqrt(x) + y", "0 * sqrt(x) + y", false},
+		{"(1 / x)^0", "(1 / x)^0", false},
+		{"1/x - 1/x", "0 * (1 / x)", true},
+		{"x * x^-1", "x * x^-1", false},
+		{"2 * x * 0", "0", true},
+		{"0 * sin(x) + y", "y", true},
+		{"2*x + y + 3*x", "5 * x + y", true},
+		{"x - x", "0", true},
+		{"a*x - 2*a*x + y", "-a * x + y", true},
+		{"x * x^2 * 3", "3 * x^3", true},
+		{"x * y / y", "x * y / y", false},
+		{"x * 2 * y * 4", "8 * x * y", true},
+		{"-(-x)", "x", true},
+		{"-(x - 3) + x", "3", true},
+		{"sqrt(16) * x", "4 * x", true},
+		{"sqrt(2) * ln(1 + 1)", "sqrt(2) * ln(2)", true},
+		{"2^10", "1024", true},
+		{"1 + 2 - 3", "0", true},
+		{"x + 1", "x + 1", false},
+		{"1 / 0 + x", "1 / 0 + x", false},
+		{"sqrt(-1)", "sqrt(-1)", false},
+		{"max(x, 2 + 3)", "max(x, 5)", true},
+		{"1 + 1 == 2", "1", true},
+		{"!(2 > 3) && x", "1 && x", true},
+		{"0 && x", "0", true},
+		{"2 || x", "1", true},
+		{"!0 + x", "x + 1", true},
+		{"-!x + 0", "-!x", true},
+		{"!x * 2 + !x", "3 * !x", true},
+		{"1 < 2 ? x * 1 : y", "x", true},
+		{"0 ? x : y + 0", "y", true},
+		{"x > 0 ? x + x : 1 / 0", "x > 0 ? 2 * x : 1 / 0", true},
+		{"7 % 3 + x // (1 + 1)", "x // 2 + 1", true},
+		{"x % 0", "x % 0", false},
+		{"1e308 * 10 + x", huge + " * 10 + x", false},
+		{"1e308 * 10 - 1e308 * 10 + x", huge + " * 10 - " + huge + " * 10 + x", false},
+		{"x * 1e308 * 10", huge + " * x * 10", true},
+		{"1e308 / 0.1 + 1", huge + " / 0.1 + 1", false},
+	}
+
+	for _, tt := range tests {
+		tree, err := ParseTree(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseTree(%q) unexpected error: %v", tt.expr, err)
+		}
+		simplified, changed := Simplify(tree)
+		if got := Format(simplified); got != tt.expected || changed != tt.changed {
+			t.Errorf("Simplify(%q) = %s, %v, expected %s, %v", tt.expr, got, changed, tt.expected, tt.changed)
+		}
+		if !changed && simplified != tree {
+			t.Errorf("Simplify(%q) returned a new tree without changes", tt.expr)
+		}
+		if _, err := ParseTree(Format(simplified)); err != nil {
+			t.Errorf("Simplify(%q) = %s, which ParseTree rejects: %v", tt.expr, Format(simplified), err)
+		}
+	}
+}
+
+// Упрощённое выражение должно вычисляться так же, как исходное
+func TestSimplifyPreservesValue(t *testing.T) {
+	exprs := []string{
+		"2*x + y + 3*x - y/2",
+		"x * x^2 * y * 3 * y",
+		"-(x - 3) * 2 + x * 4",
+		"(x + 1) * (x + 1) - x^2",
+		"sin(x)^2 + cos(x)^2 + 0 * y",
+		"x^y * x^2 / x",
+	}
+
+	env := NewEnv()
+	env.Set("x", 1.7)
+	env.Set("y", -0.4)
+	for _, expr := range exprs {
+		tree, err := ParseTree(expr)
+		if err != nil {
+			t.Fatalf("ParseTree(%q) unexpected error: %v", expr, err)
+		}
+		simplified, _ := Simplify(tree)
+		want, err := evalTree(tree, env)
+		if err != nil {
+			t.Fatalf("evalTree(%q) unexpected error: %v", expr, err)
+		}
+		got, err := evalTree(simplified, env)
+		if err != nil || math.Abs(got-want) > 1e-9 {
+			t.Errorf("Simplify(%q) = %s evaluates to %v, %v, expected %v", expr, Format(simplified), got, err, want)
+		}
+	}
+}
+
+func TestREPLSimplify(t *testing.T) {
+	input := strings.Join([]string{
+		":simplify x*1 + 2*x",
+		":simplify x + y",
+		":diff a*x^2, x",
+		":diff log(2, x)",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, NewEnv()); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> Упрощено: 3 * x\n",
+		"> Упрощать нечего: x + y\n",
+		"> Производная: 2 * a * x\n",
+		"> Производная: 1 / (x * ln(2))\n",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,526 @@
+package calc
+
+import (
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Основные величины СИ — номера показателей в dimension.
+const (
+	dimMass = iota
+	dimLength
+	dimTime
+	dimCurrent
+	dimTemperature
+	dimAmount
+	dimLuminosity
+	dimCount
+)
+
+// baseUnits — основные единицы СИ в порядке показателей dimension.
+var baseUnits = [dimCount]string{"kg", "m", "s", "A", "K", "mol", "cd"}
+
+// dimension — размерность: показатели степеней основных величин. Ускорение — m^1 s^-2.
+type dimension [dimCount]int
+
+func (d dimension) times(o dimension, sign int) dimension {
+	for i := range d {
+		d[i] += sign * o[i]
+	}
+	return d
+}
+
+func (d dimension) isZero() bool {
+	return d == dimension{}
+}
+
+// String печатает размерность основными единицами: "kg*m^2/s^2", "1/s"; у безразмерной величины — пустая строка.
+func (d dimension) String() string {
+	var num, den []string
+	for i, e := range d {
+		unit := baseUnits[i]
+		switch {
+		case e == 1 || e == -1:
+		case e > 0 || e < 0:
+			unit += "^" + strconv.Itoa(max(e, -e))
+		default:
+			continue
+		}
+		if e > 0 {
+			num = append(num, unit)
+		} else {
+			den = append(den, unit)
+		}
+	}
+	if len(den) == 0 {
+		return strings.Join(num, "*")
+	}
+	text := strings.Join(num, "*")
+	if text == "" {
+		text = "1"
+	}
+	if len(den) > 1 {
+		return text + "/(" + strings.Join(den, "*") + ")"
+	}
+	return text + "/" + den[0]
+}
+
+// quantity — значение режима units: число в основных единицах СИ и его размерность.
+type quantity struct {
+	value float64 // в основных единицах СИ: 5 km хранится как 5000
+	dim   dimension
+	// unit — единица, в которой печатается значение. У числа с единицами (100 km/h), произведений и частных
+	// таких чисел и выражения из одних единиц unit — их запись, у результата in — правая часть in,
+	// у суммы величин в одной единице — эта единица. У остальных значений unit пуст, они печатаются в основных единицах.
+	unit compoundUnit
+	pure bool // выражение только из единиц, без чисел: лишь такое может стоять справа от in
+}
+
+// unitPower — множитель составной единицы: единица измерения в степени.
+type unitPower struct {
+	name string
+	exp  float64
+}
+
+// compoundUnit — составная единица: произведение единиц в степенях в порядке их появления, km/h — km^1 h^-1.
+// Одна и та же единица встречается в ней один раз, поэтому m^2 * m — это m^3. Значения не меняются: операции создают новые.
+type compoundUnit []unitPower
+
+// times умножает единицу на o в степени sign (1 — умножение, -1 — деление), складывая показатели одинаковых единиц.
+func (u compoundUnit) times(o compoundUnit, sign int) compoundUnit {
+	result := slices.Clone(u)
+	for _, p := range o {
+		i := slices.IndexFunc(result, func(q unitPower) bool { return q.name == p.name })
+		if i < 0 {
+			result = append(result, unitPower{p.name, float64(sign) * p.exp})
+			continue
+		}
+		if result[i].exp += float64(sign) * p.exp; result[i].exp == 0 {
+			result = slices.Delete(result, i, i+1)
+		}
+	}
+	return result
+}
+
+// pow возводит единицу в степень e. Если какой-то показатель выходит дробным, возвращает nil:
+// такую величину проще напечатать в основных единицах.
+func (u compoundUnit) pow(e float64) compoundUnit {
+	result := make(compoundUnit, len(u))
+	for i, p := range u {
+		if exp := p.exp * e; exp == math.Trunc(exp) {
+			result[i] = unitPower{p.name, exp}
+		} else {
+			return nil
+		}
+	}
+	return result
+}
+
+// scale — величина единицы в основных единицах СИ: km/h — 1000/3600.
+func (u compoundUnit) scale() float64 {
+	result := 1.0
+	for _, p := range u {
+		result *= math.Pow(units[p.name].scale, p.exp)
+	}
+	return result
+}
+
+// String печатает единицу так же, как dimension.String: "km/h", "kg*m/s^2", "1/s".
+func (u compoundUnit) String() string {
+	var num, den []string
+	for _, p := range u {
+		text := p.name
+		if e := math.Abs(p.exp); e != 1 {
+			text += "^" + formatNumber(e)
+		}
+		if p.exp > 0 {
+			num = append(num, text)
+		} else {
+			den = append(den, text)
+		}
+	}
+	text := strings.Join(num, "*")
+	switch {
+	case len(den) == 0:
+		return text
+	case text == "":
+		text = "1"
+	}
+	if len(den) > 1 {
+		return text + "/(" + strings.Join(den, "*") + ")"
+	}
+	return text + "/" + den[0]
+}
+
+// number — безразмерная величина.
+func number(x float64) quantity {
+	return quantity{value: x}
+}
+
+// unitDef — единица измерения: величина в основных единицах и размерность.
+type unitDef struct {
+	scale float64
+	dim   dimension
+}
+
+// units — известные единицы измерения. Единицы СИ допускают приставки: km, ms, kN, MHz, mA.
+var units = makeUnits()
+
+func makeUnits() map[string]unitDef {
+
+	dim := func(exps ...int) dimension { // показатели в порядке kg, m, s, A
+		var d dimension
+		copy(d[:], exps)
+		return d
+	}
+	length, mass, time := dim(0, 1), dim(1), dim(0, 0, 1)
+	force := dim(1, 1, -2)
+	energy := dim(1, 2, -2)
+	power := dim(1, 2, -3)
+
+	// Единицы СИ, к которым присоединяются приставки
+	metric := map[string]unitDef{
+		"m":   {1, length},
+		"g":   {1e-3, mass},
+		"s":   {1, time},
+		"A":   {1, dim(0, 0, 0, 1)},
+		"K":   {1, dimension{dimTemperature: 1}},
+		"mol": {1, dimension{dimAmount: 1}},
+		"cd":  {1, dimension{dimLuminosity: 1}},
+		"N":   {1, force},
+		"J":   {1, energy},
+		"W":   {1, power},
+		"Pa":  {1, dim(1, -1, -2)},
+		"Hz":  {1, dim(0, 0, -1)},
+		"C":   {1, dim(0, 0, 1, 1)},
+		"V":   {1, dim(1, 2, -3, -1)},
+		"Ohm": {1, dim(1, 2, -3, -2)},
+		"L":   {1e-3, dim(0, 3)},
+	}
+	prefixes := map[string]float64{"G": 1e9, "M": 1e6, "k": 1e3, "c": 1e-2, "m": 1e-3, "u": 1e-6, "µ": 1e-6, "n": 1e-9}
+
+	table := make(map[string]unitDef)
+	for name, u := range metric {
+		table[name] = u
+		for prefix, factor := range prefixes {
+			table[prefix+name] = unitDef{u.scale * factor, u.dim}
+		}
+	}
+
+	// Единицы без приставок
+	for name, u := range map[string]unitDef{
+		"min":  {60, time},
+		"h":    {3600, time},
+		"d":    {86400, time},
+		"inch": {0.0254, length},
+		"ft":   {0.3048, length},
+		"yd":   {0.9144, length},
+		"mi":   {1609.344, length},
+		"lb":   {0.45359237, mass},
+		"t":    {1000, mass},
+		"kWh":  {3.6e6, energy},
+		"bar":  {1e5, dim(1, -1, -2)},
+		"atm":  {101325, dim(1, -1, -2)},
+	} {
+		table[name] = u
+	}
+	return table
+}
+
+// markUnits помечает имена единиц измерения как TokenUnit. Имя остаётся переменной, если она есть в env,
+// если за ним идёт скобка (min(1, 2) — функция) или ему присваивают значение.
+func markUnits(tokens []Token, env *Env) []Token {
+	for i := range tokens {
+		token := &tokens[i]
+		if token.Kind != TokenIdent {
+			continue
+		}
+		if _, ok := units[token.Text]; !ok {
+			continue
+		}
+		_, defined := env.Get(token.Text)
+		call := i+1 < len(tokens) && tokens[i+1].Kind == TokenLParen
+		assigned := i == 0 && len(tokens) > 1 && tokens[1].Kind == TokenAssign
+		if !defined && !call && !assigned {
+			token.Kind = TokenUnit
+		}
+	}
+	return tokens
+}
+
+// evaluateUnits вычисляет строку в режиме units: числа могут иметь единицы измерения.
+//
+//	5 m + 30 cm        → 5.3 m
+//	9.81 m/s^2 * 2 s   → 19.62 m/s
+//	100 km/h in m/s    → 27.7777777777778 m/s
+//
+// Единица сразу после числа, скобки или другой единицы умножается на них: 5 m — это 5 * m.
+// Такое умножение связывает сильнее * и /, поэтому число с единицей — одна величина: 10 m / 2 s — это (10 m) / (2 s),
+// а 1/2 s — это 1 / (2 s), полсекунды пишется 0.5 s или (1/2) s. Степень связывает ещё сильнее: 5 m^2 — это 5 * m^2.
+// Сложение, вычитание и сравнение величин разной размерности — ошибка ErrDimension.
+// Число с единицами печатается в них же (100 km/h), результат in — в единицах правой части,
+// произведение и частное таких чисел — в составной единице (100 km / 2 h → 50 km/h, 5 m^2 * 2 m → 10 m^3),
+// остальные результаты — в основных единицах СИ (5.3 m, 19.62 m/s). Безразмерный результат печатается без единиц.
+// Единицы только мультипликативные: градусы Цельсия не поддерживаются, температура — в K.
+func evaluateUnits(line string, env *Env) (quantity, error) {
+
+	tokens, err := tokenizeWith(line, env.operators())
+	if err != nil {
+		return quantity{}, err
+	}
+	name, postfix, err := parseTokens(markUnits(tokens, env), env)
+	if err != nil {
+		return quantity{}, err
+	}
+	result, err := evaluatePostfixUnits(postfix, env)
+	if err != nil {
+		return quantity{}, err
+	}
+
+	if name != "" {
+		env.setQuantity(name, result)
+	}
+	return result, nil
+}
+
+// evaluatePostfixUnits вычисляет постфиксную запись, в которой единицы уже помечены markUnits.
+func evaluatePostfixUnits(postfix []Token, env *Env) (quantity, error) {
+	return runPostfix[quantity](postfix, env, unitArithmetic{})
+}
+
+// formatQuantity печатает величину с единицами: "5.3 m", "27.7777777777778 m/s"; digits как у session.formatNumber.
+func formatQuantity(q quantity, digits int) string {
+	format := func(x float64) string {
+		if digits >= 0 {
+			return strconv.FormatFloat(x, 'f', digits, 64)
+		}
+		return formatNumber(x)
+	}
+	if len(q.unit) > 0 {
+		return format(q.value/q.unit.scale()) + " " + q.unit.String()
+	}
+	if q.dim.isZero() {
+		return format(q.value)
+	}
+	return format(q.value) + " " + q.dim.String()
+}
+
+// unitArithmetic — вычисление величин с размерностями.
+type unitArithmetic struct{}
+
+func (unitArithmetic) number(tok Token) (quantity, error) {
+	if tok.Kind == TokenUnit {
+		return unitQuantity(tok.Text), nil
+	}
+	if err := realOnly(tok); err != nil {
+		return quantity{}, err
+	}
+	return number(tok.Value), inRange(tok)
+}
+
+func unitQuantity(name string) quantity {
+	u := units[name]
+	return quantity{value: u.scale, dim: u.dim, unit: compoundUnit{{name, 1}}, pure: true}
+}
+
+// variable ищет переменную, а если её нет — единицу: в теле функции пользователя имена единиц не помечаются.
+func (unitArithmetic) variable(tok Token, env *Env) (quantity, error) {
+	if q, ok := env.getQuantity(tok.Text); ok {
+		return q, nil
+	}
+	if _, ok := env.Get(tok.Text); !ok {
+		if _, isUnit := units[tok.Text]; isUnit {
+			return unitQuantity(tok.Text), nil
+		}
+	}
+	value, err := lookupVariable(tok, env, tok.Text)
+	if err != nil {
+		return quantity{}, err
+	}
+	return number(value), nil
+}
+
+func (unitArithmetic) prefix(tok Token, _ *Operator, x quantity) (quantity, error) {
+	if tok.Text != unaryMinus {
+		return quantity{}, unsupportedOperator(tok)
+	}
+	return quantity{value: -x.value, dim: x.dim, unit: x.unit}, nil
+}
+
+func (a unitArithmetic) binary(tok Token, op *Operator, left, right quantity) (quantity, error) {
+
+	switch tok.Text {
+	case "+", "-":
+		if err := sameDimension(tok, left, right); err != nil {
+			return quantity{}, err
+		}
+		if tok.Text == "-" {
+			right.value = -right.value
+		}
+		q := quantity{value: left.value + right.value, dim: left.dim}
+		if slices.Equal(left.unit, right.unit) {
+			q.unit = left.unit
+		}
+		return q, nil
+
+	case "*":
+		q := quantity{value: left.value * right.value, dim: left.dim.times(right.dim, 1), pure: left.pure && right.pure}
+		q.unit = productUnit(left, right, 1)
+		return q, nil
+
+	case "/":
+		if right.value == 0 {
+			return quantity{}, errorAt(ErrDivisionByZero, tok, "деление на ноль")
+		}
+		q := quantity{value: left.value / right.value, dim: left.dim.times(right.dim, -1), pure: left.pure && right.pure}
+		q.unit = productUnit(left, right, -1)
+		return q, nil
+
+	case "%", "//":
+		// 7.5 m % 2 m = 1.5 m, 7.5 m // 2 m = 3: делятся с остатком только величины одной размерности
+		if err := sameDimension(tok, left, right); err != nil {
+			return quantity{}, err
+		}
+		value, err := applyOperator(tok, op, left.value, right.value)
+		if err != nil || tok.Text == "//" {
+			return number(value), err
+		}
+		return quantity{value: value, dim: left.dim}, nil
+
+	case "^":
+		return unitPow(tok, left, right)
+
+	case "in":
+		// Значение не меняется, меняется только единица, в которой оно печатается
+		if !right.pure {
+			return quantity{}, errorAt(ErrDimension, tok, "справа от in должны быть только единицы измерения, без чисел")
+		}
+		if err := sameDimension(tok, left, right); err != nil {
+			return quantity{}, err
+		}
+		return quantity{value: left.value, dim: left.dim, unit: right.unit}, nil
+	}
+
+	if isComparison(tok.Text) {
+		if err := sameDimension(tok, left, right); err != nil {
+			return quantity{}, err
+		}
+		var c int
+		switch {
+		case left.value < right.value:
+			c = -1
+		case left.value > right.value:
+			c = 1
+		}
+		return a.boolean(compareResult(tok.Text, c)), nil
+	}
+	return quantity{}, unsupportedOperator(tok)
+}
+
+// productUnit — единица произведения (sign = 1) или частного (sign = -1) величин. Она есть, если единицы есть
+// у обеих величин или у одной из них, а другая — просто число: 120 km печатается в километрах, 100 km / 2 h — в km/h.
+// Величина, которая печатается в основных единицах, и безразмерный результат (6 m / 3 m) единицы не получают.
+func productUnit(left, right quantity, sign int) compoundUnit {
+	switch {
+	case left.dim.times(right.dim, sign).isZero():
+		return nil
+	case len(left.unit) > 0 && (len(right.unit) > 0 || right.dim.isZero()):
+		return left.unit.times(right.unit, sign)
+	case len(right.unit) > 0 && left.dim.isZero():
+		return compoundUnit(nil).times(right.unit, sign)
+	}
+	return nil
+}
+
+// sameDimension проверяет, что у величин одна размерность: складывать метры с секундами нельзя.
+func sameDimension(tok Token, left, right quantity) error {
+	if left.dim == right.dim {
+		return nil
+	}
+	return errorAt(ErrDimension, tok, "несовместимые размерности: %s и %s", dimensionName(left.dim), dimensionName(right.dim))
+}
+
+func dimensionName(d dimension) string {
+	if d.isZero() {
+		return "безразмерная величина"
+	}
+	return d.String()
+}
+
+// unitPow возводит величину в безразмерную степень. Показатели размерности должны остаться целыми:
+// (m^2)^0.5 = m, а m^0.5 — ошибка.
+func unitPow(tok Token, base, exp quantity) (quantity, error) {
+
+	if !exp.dim.isZero() {
+		return quantity{}, errorAt(ErrDimension, tok, "показатель степени должен быть безразмерным, а не %s", exp.dim)
+	}
+	q := quantity{value: math.Pow(base.value, exp.value)}
+	for i, e := range base.dim {
+		power := float64(e) * exp.value
+		if power != math.Trunc(power) {
+			return quantity{}, errorAt(ErrDimension, tok, "%s в степени %s не имеет целой размерности", base.dim, formatNumber(exp.value))
+		}
+		q.dim[i] = int(power)
+	}
+	if len(exp.unit) == 0 && !q.dim.isZero() {
+		q.unit, q.pure = base.unit.pow(exp.value), base.pure
+	}
+	return q, nil
+}
+
+func (unitArithmetic) call(tok Token, args []quantity) (quantity, error) {
+
+	if err := checkCall(tok, tok.Text, len(args)); err != nil {
+		return quantity{}, err
+	}
+
+	switch tok.Text {
+	case "sqrt":
+		return unitPow(tok, args[0], number(0.5))
+	case "abs":
+		return quantity{value: math.Abs(args[0].value), dim: args[0].dim}, nil
+	case "min", "max", "sum", "avg", "median", "var", "stddev", "hypot":
+		// Сравнивать и складывать можно только величины одной размерности
+		values := make([]float64, len(args))
+		for i, arg := range args {
+			if err := sameDimension(tok, args[0], arg); err != nil {
+				return quantity{}, err
+			}
+			values[i] = arg.value
+		}
+		result, err := callFunction(tok, tok.Text, values)
+		dim := args[0].dim
+		if tok.Text == "var" {
+			dim = dim.times(dim, 1) // дисперсия метров — квадратные метры
+		}
+		return quantity{value: result, dim: dim}, err
+	case "prod":
+		result := number(1)
+		for _, arg := range args {
+			result.value *= arg.value
+			result.dim = result.dim.times(arg.dim, 1)
+		}
+		return result, nil
+	}
+
+	// Остальные функции определены только для безразмерных аргументов: sin(5 m) не имеет смысла
+	values := make([]float64, len(args))
+	for i, arg := range args {
+		if !arg.dim.isZero() {
+			return quantity{}, errorAt(ErrDimension, tok, "аргумент функции %s должен быть безразмерным, а не %s", tok.Text, arg.dim)
+		}
+		values[i] = arg.value
+	}
+	result, err := callFunction(tok, tok.Text, values)
+	return number(result), err
+}
+
+func (unitArithmetic) truth(x quantity) bool {
+	return x.value != 0
+}
+
+func (unitArithmetic) boolean(b bool) quantity {
+	return number(boolToFloat(b))
+}
@@ -0,0 +1,191 @@
+package calc
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEvaluateUnits(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"5 m + 30 cm", "5.3 m"},
+		{"9.81 m/s^2 * 2 s", "19.62 m/s"},
+		{"100 km/h in m/s", "27.7777777777778 m/s"},
+		{"36 km/h in m/s", "10 m/s"},
+		{"1 mi in km", "1.609344 km"},
+		{"2 h + 30 min in min", "150 min"},
+		{"3 N * 2 m in J", "6 J"},
+		{"1 kWh in J", "3600000 J"},
+		{"(2 m)^2", "4 m^2"},
+		{"sqrt(16 m^2)", "4 m"},
+		{"1 / (4 s)", "0.25 1/s"},
+		{"5 kg * 9.8 m/s^2", "49 kg*m/s^2"},
+		{"10 m / (2 m)", "5"},
+		{"-(3 m) + 1 m", "-2 m"},
+		{"max(1 m, 50 cm)", "1 m"},
+		{"sum([1 km, 500 m])", "1500 m"},
+		{"avg(1 m, 3 m)", "2 m"},
+		{"var(1 m, 3 m)", "2 m^2"},
+		{"prod(2 m, 3 m, 4)", "24 m^2"},
+		{"hypot(3 m, 4 m)", "5 m"},
+		{"1 km > 999 m", "1"},
+		{"1 L in cm^3", "1000 cm^3"},
+		{"2 * 3", "6"},
+		{"sin(0)", "0"},
+		{"7.5 m % (2 m)", "1.5 m"},
+		{"1 km // (300 m)", "3"},
+		{"10 m / 2 s", "5 m/s"},
+		{"100 km / 2 h", "50 km/h"},
+		{"6 m / 3 m", "2"},
+		{"5 m^2 * m", "5 m^3"},
+		{"2 m * 3 m", "6 m^2"},
+		{"100 km/h * 2 h", "200 km"},
+		{"1/2 s", "0.5 1/s"},
+		{"(1/2) s", "0.5 s"},
+		{"(100 km/h)^2", "10000 km^2/h^2"},
+	}
+
+	for _, tt := range tests {
+		result, err := evaluateUnits(tt.expr, NewEnv())
+		if err != nil {
+			t.Errorf("evaluateUnits(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if got := formatQuantity(result, -1); got != tt.expected {
+			t.Errorf("evaluateUnits(%q) = %s, expected %s", tt.expr, got, tt.expected)
+		}
+	}
+}
+
+func TestEvaluateUnitsErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		code ErrorCode
+		pos  int
+	}{
+		{"5 m + 3 s", ErrDimension, 4},
+		{"1 km/h in m", ErrDimension, 7},
+		{"1 m < 2 kg", ErrDimension, 4},
+		{"10 m in 2 cm", ErrDimension, 5},
+		{"sin(1 m)", ErrDimension, 0},
+		{"2^(1 s)", ErrDimension, 1},
+		{"(1 m)^0.5", ErrDimension, 5},
+		{"5 m / (0 s)", ErrDivisionByZero, 4},
+		{"3i m", ErrDomain, 0},
+		{"5 m +", ErrMissingOperand, 5},
+		{"5 m % 2", ErrDimension, 4},
+		{"5 m // (0 m)", ErrDivisionByZero, 4},
+		{"sum(1 m, 2 s)", ErrDimension, 0},
+	}
+
+	for _, tt := range tests {
+		_, err := evaluateUnits(tt.expr, NewEnv())
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code || calcErr.Pos != tt.pos {
+			t.Errorf("evaluateUnits(%q) error = %#v, expected %v at %d", tt.expr, err, tt.code, tt.pos)
+		}
+	}
+}
+
+func TestUnitsImplicitMultiplication(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected []string
+	}{
+		{"5 m + 30 cm", []string{"5", "m", "*", "30", "cm", "*", "+"}},
+		{"9.81 m/s^2", []string{"9.81", "m", "*", "s", "2", "^", "/"}},
+		{"100 km/h in m/s", []string{"100", "km", "*", "h", "/", "m", "s", "/", "in"}},
+		{"(1 + 2) kg", []string{"1", "2", "+", "kg", "*"}},
+		{"10 m / 2 s", []string{"10", "m", "*", "2", "s", "*", "/"}},
+		{"1/2 s", []string{"1", "2", "s", "*", "/"}},
+		{"5 m^2 * m", []string{"5", "m", "2", "^", "*", "m", "*"}},
+		{"-5 m", []string{"5", "u-", "m", "*"}},
+	}
+
+	for _, tt := range tests {
+		tokens, err := tokenize(tt.expr)
+		if err != nil {
+			t.Fatalf("tokenize(%q) unexpected error: %v", tt.expr, err)
+		}
+		_, postfix, err := parseTokens(markUnits(tokens, NewEnv()), NewEnv())
+		if err != nil {
+			t.Errorf("parseTokens(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(textsOf(postfix), tt.expected) {
+			t.Errorf("parseTokens(%q) = %v, expected %v", tt.expr, textsOf(postfix), tt.expected)
+		}
+	}
+}
+
+func TestUnitsVariables(t *testing.T) {
+	env := NewEnv()
+	steps := []struct {
+		expr     string
+		expected string
+	}{
+		{"d = 120 km", "120 km"},
+		{"t = 1.5 h", "1.5 h"},
+		{"d / t in km/h", "80 km/h"},
+		// Переменная с именем единицы закрывает единицу
+		{"m = 3", "3"},
+		{"m * 2 kg", "6 kg"},
+		{"min(1, 2)", "1"},
+	}
+	for _, tt := range steps {
+		result, err := evaluateUnits(tt.expr, env)
+		if err != nil {
+			t.Fatalf("evaluateUnits(%q) unexpected error: %v", tt.expr, err)
+		}
+		if got := formatQuantity(result, -1); got != tt.expected {
+			t.Errorf("evaluateUnits(%q) = %s, expected %s", tt.expr, got, tt.expected)
+		}
+	}
+
+	// В других режимах величина с размерностью недоступна, а in и единицы — ошибки
+	var calcErr *CalcError
+	for _, expr := range []string{"d + 1", "2 in 3", "5 km"} {
+		if _, err := evaluate(expr, env); !errors.As(err, &calcErr) {
+			t.Errorf("evaluate(%q) error = %v, expected *CalcError", expr, err)
+		}
+	}
+	if _, err := evaluate("d + 1", env); !errors.As(err, &calcErr) || calcErr.Code != ErrDimension {
+		t.Errorf("evaluate(\"d + 1\") error = %v, expected dimension error", err)
+	}
+}
+
+func TestREPLUnitsMode(t *testing.T) {
+	input := strings.Join([]string{
+		":mode units",
+		"5 m + 30 cm",
+		"ans in cm",
+		"v = 100 km/h",
+		":digits 2",
+		"v in m/s",
+		"5 m + 3 s",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, NewEnv()); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> Режим: units\n",
+		"> 5.3 m\n",
+		"> 530 cm\n",
+		"> 100 km/h\n",
+		"> 27.78 m/s\n",
+		"несовместимые размерности: m и s",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+}
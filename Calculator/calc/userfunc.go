@@ -0,0 +1,132 @@
+package calc
+
+import (
+	"errors"
+	"strings"
+)
+
+// maxCallDepth ограничивает вложенность вызовов функций пользователя. Рекурсию останавливает условное выражение,
+// fact(n) = n <= 1 ? 1 : n * fact(n - 1), но без него (или с условием, которое не наступает) f(x) = f(x - 1)
+// не остановится сама. Предел с запасом покрывает честную рекурсию на тысячи шагов.
+const maxCallDepth = 10000
+
+// userFunction — функция, определённая пользователем: f(x, y) = x^2 + y.
+// Тело хранится в постфиксной записи; функции, которые оно вызывает, ищутся в окружении в момент вызова,
+// поэтому переопределение вызываемой функции меняет и поведение вызывающей.
+type userFunction struct {
+	Name   string
+	Params []string
+	Body   string  // тело в исходной записи, для печати
+	code   []Token // тело в постфиксной записи
+}
+
+// String печатает определение в виде "f(x, y) = x^2 + y".
+func (fn *userFunction) String() string {
+	return fn.Name + "(" + strings.Join(fn.Params, ", ") + ") = " + fn.Body
+}
+
+// signature описывает функцию для разбора вызовов: важно только число аргументов.
+func (fn *userFunction) signature() function {
+	return function{minArgs: len(fn.Params), maxArgs: len(fn.Params)}
+}
+
+// define разбирает определение функции "f(x, y) = x^2 + y" и сохраняет его в env.
+// Если строка не является определением, возвращает nil без ошибки — это выражение или присваивание.
+// Тело может вызывать встроенные функции, уже определённые функции пользователя и саму определяемую функцию.
+func define(line string, env *Env) (*userFunction, error) {
+
+	tokens, err := tokenizeWith(line, env.operators())
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) < 2 || tokens[0].Kind != TokenIdent || tokens[1].Kind != TokenLParen {
+		return nil, nil
+	}
+	closing := 2
+	for closing < len(tokens) && tokens[closing].Kind != TokenRParen {
+		closing++
+	}
+	if closing+1 >= len(tokens) || tokens[closing+1].Kind != TokenAssign {
+		return nil, nil
+	}
+
+	fn := &userFunction{Name: tokens[0].Text}
+	if isBuiltin(fn.Name) {
+		return nil, errorAt(ErrAssignment, tokens[0], "имя %s занято встроенной функцией", fn.Name)
+	}
+	if env == nil {
+		return nil, errorAt(ErrAssignment, tokens[closing+1], "определение функции невозможно без окружения")
+	}
+
+	// Параметры — разные имена через запятую
+	seen := make(map[string]bool)
+	for i, tok := range tokens[2:closing] {
+		wantIdent := i%2 == 0
+		if wantIdent && tok.Kind != TokenIdent || !wantIdent && tok.Kind != TokenComma {
+			return nil, errorAt(ErrAssignment, tok, "ожидалось имя параметра функции %s", fn.Name)
+		}
+		if !wantIdent {
+			continue
+		}
+		if seen[tok.Text] {
+			return nil, errorAt(ErrAssignment, tok, "параметр %s повторяется", tok.Text)
+		}
+		seen[tok.Text] = true
+		fn.Params = append(fn.Params, tok.Text)
+	}
+	if closing > 2 && tokens[closing-1].Kind == TokenComma {
+		return nil, errorAt(ErrAssignment, tokens[closing-1], "ожидалось имя параметра функции %s", fn.Name)
+	}
+
+	body := tokens[closing+2:]
+	if len(body) == 0 {
+		return nil, errorAt(ErrAssignment, tokens[closing+1], "пропущено тело функции %s", fn.Name)
+	}
+	fn.Body = strings.TrimSpace(string([]rune(line)[body[0].Pos:]))
+
+	// Сама функция видна в своём теле, чтобы её можно было вызвать рекурсивно
+	fn.code, err = infixToPostfixWith(body, func(name string) (function, bool) {
+		if name == fn.Name {
+			return fn.signature(), true
+		}
+		return env.resolve(name)
+	}, env.operators())
+	if err != nil {
+		return nil, err
+	}
+
+	env.defineFunction(fn)
+	return fn, nil
+}
+
+// callUser вычисляет тело функции пользователя fn с аргументами args в той же числовой системе.
+// Ошибка внутри тела указывает на место вызова: позиции в теле к строке, где функцию вызвали, не относятся.
+func callUser[T any](tok Token, fn *userFunction, args []T, env *Env, arith arithmetic[T], depth int) (T, error) {
+
+	var zero T
+	if len(args) != len(fn.Params) {
+		return zero, errorAt(ErrArity, tok, "%v", checkArity(fn.Name, fn.signature(), len(args)))
+	}
+	if depth >= maxCallDepth {
+		return zero, errorAt(ErrDomain, tok, "превышена глубина вложенных вызовов функций (%d)", maxCallDepth)
+	}
+
+	params := make(map[string]T, len(args))
+	for i, name := range fn.Params {
+		params[name] = args[i]
+	}
+	result, err := runScoped(fn.code, env, arith, params, depth+1)
+
+	var calcErr *CalcError
+	if !errors.As(err, &calcErr) {
+		return result, err
+	}
+	// Ошибку из вложенного вызова только переносим на этот вызов: имя функции, где она случилась, уже в сообщении
+	msg := calcErr.Msg
+	if _, nested := calcErr.Err.(*CalcError); !nested {
+		msg = "в функции " + fn.Name + ": " + msg
+	}
+	wrapped := errorAt(calcErr.Code, tok, "%s", msg)
+	wrapped.Err = calcErr
+	return zero, wrapped
+}
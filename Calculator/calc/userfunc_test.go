@@ -0,0 +1,181 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestUserFunctions(t *testing.T) {
+	env := NewEnv()
+	definitions := []struct {
+		line     string
+		expected string
+	}{
+		{"f(x, y) = x^2 + y", "f(x, y) = x^2 + y"},
+		{"g(x) =  2 * f(x, 1) ", "g(x) = 2 * f(x, 1)"},
+		{"area(r) = pi * r^2", "area(r) = pi * r^2"},
+		{"answer() = 42", "answer() = 42"},
+		{"fact(n) = n <= 1 ? 1 : n * fact(n - 1)", "fact(n) = n <= 1 ? 1 : n * fact(n - 1)"},
+		{"tri(n) = n <= 0 ? 0 : n + tri(n - 1)", "tri(n) = n <= 0 ? 0 : n + tri(n - 1)"},
+	}
+	for _, d := range definitions {
+		fn, err := define(d.line, env)
+		if err != nil {
+			t.Fatalf("define(%q) unexpected error: %v", d.line, err)
+		}
+		if fn == nil || fn.String() != d.expected {
+			t.Errorf("define(%q) = %v, expected %s", d.line, fn, d.expected)
+		}
+	}
+
+	env.Set("x", 100)
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"f(3, 4)", 13},
+		{"g(3)", 20},
+		{"f(g(1), -1)", 15},
+		{"area(2)", 4 * math.Pi},
+		{"answer() + x", 142}, // x вне тела — обычная переменная
+		{"sqrt(f(0, 16))", 4},
+		{"fact(5)", 120}, // рекурсия останавливается условным выражением
+		{"fact(150) / fact(149)", 150},
+		{"tri(5000)", 12502500},
+	}
+	for _, tt := range tests {
+		result, err := evaluate(tt.expr, env)
+		if err != nil {
+			t.Errorf("evaluate(%q) unexpected error: %v", tt.expr, err)
+			continue
+		}
+		if math.Abs(result-tt.expected) > 1e-9 {
+			t.Errorf("evaluate(%q) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+
+	// Переопределение вызываемой функции меняет и вызывающую
+	if _, err := define("f(x, y) = x + y", env); err != nil {
+		t.Fatalf("define unexpected error: %v", err)
+	}
+	if result, err := evaluate("g(3)", env); err != nil || result != 8 {
+		t.Errorf("g(3) after redefinition = %v, %v, expected 8", result, err)
+	}
+}
+
+func TestUserFunctionsInOtherModes(t *testing.T) {
+	env := NewEnv()
+	if _, err := define("h(a, b) = a / b + 1", env); err != nil {
+		t.Fatalf("define unexpected error: %v", err)
+	}
+
+	exact, err := evaluateRat("h(1, 3)", env)
+	if err != nil || exact.RatString() != "4/3" {
+		t.Errorf("evaluateRat(h(1, 3)) = %v, %v, expected 4/3", exact, err)
+	}
+	z, err := evaluateComplex("h(i, 1)", env)
+	if err != nil || z != 1+1i {
+		t.Errorf("evaluateComplex(h(i, 1)) = %v, %v, expected 1+1i", z, err)
+	}
+}
+
+func TestDefineNotADefinition(t *testing.T) {
+	for _, line := range []string{"x = 3", "sqrt(4)", "f(2) + 1", "max(1, 2) * 3"} {
+		fn, err := define(line, NewEnv())
+		if fn != nil || err != nil {
+			t.Errorf("define(%q) = %v, %v, expected nil, nil", line, fn, err)
+		}
+	}
+}
+
+func TestDefineErrors(t *testing.T) {
+	tests := []struct {
+		line string
+		code ErrorCode
+		pos  int
+	}{
+		{"sqrt(x) = x", ErrAssignment, 0},
+		{"f(x, x) = x", ErrAssignment, 5},
+		{"f(1) = 2", ErrAssignment, 2},
+		{"f(x,) = x", ErrAssignment, 3},
+		{"f(x) =", ErrAssignment, 5},
+		{"f(x) = x +", ErrMissingOperand, 10},
+		{"f(x) = g(x)", ErrUnknownFunction, 7},
+		{"f(x) = f(x, 1)", ErrArity, 7},
+	}
+
+	for _, tt := range tests {
+		_, err := define(tt.line, NewEnv())
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code || calcErr.Pos != tt.pos {
+			t.Errorf("define(%q) error = %#v, expected code %d at %d", tt.line, err, tt.code, tt.pos)
+		}
+	}
+}
+
+func TestUserFunctionErrors(t *testing.T) {
+	env := NewEnv()
+	for _, line := range []string{"inv(x) = 1 / x", "twice(x) = 2 * inv(x)", "loop(x) = loop(x - 1) + 1", "useY(x) = x + y"} {
+		if _, err := define(line, env); err != nil {
+			t.Fatalf("define(%q) unexpected error: %v", line, err)
+		}
+	}
+
+	tests := []struct {
+		expr string
+		code ErrorCode
+		pos  int
+		msg  string
+	}{
+		{"1 + twice(0)", ErrDivisionByZero, 4, "в функции inv: деление на ноль"},
+		{"loop(1)", ErrDomain, 0, "в функции loop: превышена глубина вложенных вызовов функций (10000)"},
+		{"2 * useY(1)", ErrUndefinedVariable, 4, "в функции useY: неизвестная переменная: y"},
+	}
+	for _, tt := range tests {
+		_, err := evaluate(tt.expr, env)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code || calcErr.Pos != tt.pos || calcErr.Msg != tt.msg {
+			t.Errorf("evaluate(%q) error = %#v, expected code %d at %d: %s", tt.expr, err, tt.code, tt.pos, tt.msg)
+		}
+	}
+
+	var undefined *UndefinedVariableError
+	if _, err := evaluate("useY(1)", env); !errors.As(err, &undefined) || undefined.Name != "y" {
+		t.Errorf("evaluate(useY(1)) error = %v, expected *UndefinedVariableError for y", err)
+	}
+}
+
+func TestREPLUserFunctions(t *testing.T) {
+	input := strings.Join([]string{
+		"f(x, y) = x^2 + y",
+		"f(2, 1)",
+		"sqrt(x) = x",
+		":postfix f(2, 1) * 3",
+		":tree f(x, 1) + 1",
+		":simplify f(x, 0 * x)",
+		":vars",
+	}, "\n")
+
+	var out strings.Builder
+	if err := RunREPL(strings.NewReader(input), &out, &Env{}); err != nil {
+		t.Fatalf("RunREPL unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"> f(x, y) = x^2 + y\n",
+		"> 5\n",
+		"Ошибка: имя sqrt занято встроенной функцией",
+		"> Постфиксная запись: [2 1 f(2) 3 *]\n",
+		"> Дерево: f(x, 1) + 1\n",
+		"> Упрощено: f(x, 0)\n",
+		"> ans = 5\nf(x, y) = x^2 + y\n",
+	}
+	got := out.String()
+	for _, want := range expected {
+		if !strings.Contains(got, want) {
+			t.Errorf("REPL output does not contain %q:\n%s", want, got)
+		}
+	}
+}
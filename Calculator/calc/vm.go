@@ -0,0 +1,261 @@
+package calc
+
+import (
+	"math"
+)
+
+// opcode — команда виртуальной машины Program.
+type opcode uint8
+
+const (
+	opConst opcode = iota // положить в стек константу consts[arg]
+	opVar                 // положить в стек значение переменной из ячейки arg
+	opNeg                 // сменить знак вершины стека
+	opAdd
+	opSub
+	opMul
+	opDiv
+	opPow
+	opCall // вызвать функцию funcs[arg] с argc аргументами с вершины стека
+	opEq
+	opNe
+	opLt
+	opLe
+	opGt
+	opGe
+	opNot       // логическое отрицание вершины стека
+	opBool      // привести вершину стека к 0 или 1
+	opJumpFalse // снять условие со стека и, если оно ложно, пропустить arg команд
+	opJump      // пропустить arg команд
+	opMod       // остаток со знаком делителя
+	opFloorDiv  // частное, округлённое вниз
+)
+
+// comparisonOps — команды операторов сравнения.
+var comparisonOps = map[string]opcode{"==": opEq, "!=": opNe, "<": opLt, "<=": opLe, ">": opGt, ">=": opGe}
+
+// instruction — одна команда программы. tok — номер токена постфиксной записи, на который укажет ошибка.
+type instruction struct {
+	op   opcode
+	arg  int32
+	argc int32
+	tok  int32
+}
+
+// Program — выражение, разобранное один раз и готовое к многократному вычислению.
+// Константы уже разобраны, переменные пронумерованы, функции найдены, поэтому Eval не разбирает строк
+// и не выделяет память (кроме случая ошибки).
+//
+// pi и e подставляются как константы. Program хранит свой стек вычислений, поэтому одну программу
+// нельзя вычислять одновременно из нескольких горутин; для этого нужна отдельная программа на каждую.
+type Program struct {
+	code   []instruction
+	consts []float64
+	vars   []string
+	funcs  []function
+	tokens []Token // постфиксная запись, по которой собрана программа, — для позиций ошибок
+	stack  []float64
+}
+
+// Compile разбирает выражение в программу. Ошибки разбора те же, что у toPostfix.
+// Каждому токену постфиксной записи соответствует ровно одна команда, поэтому переходы
+// условного выражения, && и || переносятся в программу без пересчёта.
+func Compile(expr string) (*Program, error) {
+
+	postfix, err := toPostfix(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Program{tokens: postfix}
+	slots := make(map[string]int32)
+	depth, maxDepth := 0, 0
+
+	for i, token := range postfix {
+		in := instruction{tok: int32(i)}
+
+		switch token.Kind {
+		case TokenNumber:
+			if err := inRange(token); err != nil {
+				return nil, err
+			}
+			in.op, in.arg = opConst, int32(len(p.consts))
+			p.consts = append(p.consts, token.Value)
+			depth++
+
+		case TokenIdent:
+			if value, ok := NewEnv().Get(token.Text); ok {
+				in.op, in.arg = opConst, int32(len(p.consts))
+				p.consts = append(p.consts, value)
+			} else {
+				slot, ok := slots[token.Text]
+				if !ok {
+					slot = int32(len(p.vars))
+					slots[token.Text] = slot
+					p.vars = append(p.vars, token.Text)
+				}
+				in.op, in.arg = opVar, slot
+			}
+			depth++
+
+		case TokenCall:
+			if err := checkCall(token, token.Text, token.Argc); err != nil {
+				return nil, err
+			}
+			in.op, in.arg, in.argc = opCall, int32(len(p.funcs)), int32(token.Argc)
+			p.funcs = append(p.funcs, functions[token.Text])
+			depth += 1 - token.Argc
+
+		case TokenJumpIfFalse:
+			in.op, in.arg = opJumpFalse, int32(token.Argc)
+			depth--
+
+		case TokenJump:
+			// Вычисляется только одна из веток, поэтому результат ветки "да" на глубину ветки "нет" не влияет
+			in.op, in.arg = opJump, int32(token.Argc)
+			depth--
+
+		case TokenOperator:
+			op, comparison := comparisonOps[token.Text]
+			switch {
+			case comparison:
+				in.op = op
+			case token.Text == logicalNot:
+				in.op = opNot
+			case token.Text == toBoolean:
+				in.op = opBool
+			case token.Text == unaryMinus:
+				in.op = opNeg
+			case token.Text == "+":
+				in.op = opAdd
+			case token.Text == "-":
+				in.op = opSub
+			case token.Text == "*":
+				in.op = opMul
+			case token.Text == "/":
+				in.op = opDiv
+			case token.Text == "^" || token.Text == "**":
+				in.op = opPow
+			case token.Text == "%":
+				in.op = opMod
+			case token.Text == "//":
+				in.op = opFloorDiv
+			default:
+				return nil, errorAt(ErrUnknownToken, token, "неизвестный токен: %s", token.Text)
+			}
+			if in.op != opNeg && in.op != opNot && in.op != opBool {
+				depth--
+			}
+
+		default:
+			if err := realOnly(token); err != nil {
+				return nil, err
+			}
+			return nil, errorAt(ErrUnknownToken, token, "неизвестный токен: %s", token.Text)
+		}
+
+		p.code = append(p.code, in)
+		maxDepth = max(maxDepth, depth)
+	}
+
+	p.stack = make([]float64, 0, maxDepth)
+	return p, nil
+}
+
+// Vars возвращает имена переменных программы в порядке их ячеек: значения для Eval передаются в том же порядке.
+func (p *Program) Vars() []string {
+	return append([]string(nil), p.vars...)
+}
+
+// Eval вычисляет программу при значениях переменных vars, перечисленных в порядке Vars.
+// Ошибки — *CalcError с позицией в исходном выражении, как у evaluatePostfix.
+func (p *Program) Eval(vars []float64) (float64, error) {
+
+	if len(vars) != len(p.vars) {
+		return 0, &CalcError{Code: ErrEvaluation, Pos: -1, Msg: "неверное число значений переменных"}
+	}
+
+	stack := p.stack[:0] // ёмкости хватает на всю программу, append не выделяет память
+	for i := 0; i < len(p.code); i++ {
+		in := &p.code[i]
+		top := len(stack) - 1
+
+		switch in.op {
+		case opConst:
+			stack = append(stack, p.consts[in.arg])
+		case opVar:
+			stack = append(stack, vars[in.arg])
+		case opNeg:
+			stack[top] = -stack[top]
+		case opAdd:
+			stack[top-1] += stack[top]
+			stack = stack[:top]
+		case opSub:
+			stack[top-1] -= stack[top]
+			stack = stack[:top]
+		case opMul:
+			stack[top-1] *= stack[top]
+			stack = stack[:top]
+		case opDiv:
+			if stack[top] == 0 {
+				return 0, errorAt(ErrDivisionByZero, p.tokens[in.tok], "деление на ноль")
+			}
+			stack[top-1] /= stack[top]
+			stack = stack[:top]
+		case opPow:
+			stack[top-1] = math.Pow(stack[top-1], stack[top])
+			stack = stack[:top]
+		case opMod, opFloorDiv:
+			if stack[top] == 0 {
+				tok := p.tokens[in.tok]
+				return 0, errorAt(ErrDivisionByZero, tok, "%s", divisionByZero(tok.Text))
+			}
+			if in.op == opMod {
+				stack[top-1] = floorMod(stack[top-1], stack[top])
+			} else {
+				stack[top-1] = math.Floor(stack[top-1] / stack[top])
+			}
+			stack = stack[:top]
+		case opCall:
+			base := len(stack) - int(in.argc)
+			result, err := p.funcs[in.arg].apply(stack[base:])
+			if err != nil {
+				calcErr := errorAt(ErrDomain, p.tokens[in.tok], "%v", err)
+				calcErr.Err = err
+				return 0, calcErr
+			}
+			stack = append(stack[:base], result)
+		case opEq:
+			stack[top-1] = boolToFloat(stack[top-1] == stack[top])
+			stack = stack[:top]
+		case opNe:
+			stack[top-1] = boolToFloat(stack[top-1] != stack[top])
+			stack = stack[:top]
+		case opLt:
+			stack[top-1] = boolToFloat(stack[top-1] < stack[top])
+			stack = stack[:top]
+		case opLe:
+			stack[top-1] = boolToFloat(stack[top-1] <= stack[top])
+			stack = stack[:top]
+		case opGt:
+			stack[top-1] = boolToFloat(stack[top-1] > stack[top])
+			stack = stack[:top]
+		case opGe:
+			stack[top-1] = boolToFloat(stack[top-1] >= stack[top])
+			stack = stack[:top]
+		case opNot:
+			stack[top] = boolToFloat(stack[top] == 0)
+		case opBool:
+			stack[top] = boolToFloat(stack[top] != 0)
+		case opJumpFalse:
+			if stack[top] == 0 {
+				i += int(in.arg)
+			}
+			stack = stack[:top]
+		case opJump:
+			i += int(in.arg)
+		}
+	}
+
+	return stack[0], nil
+}
@@ -0,0 +1,167 @@
+package calc
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+const benchExpr = "x^2 + 3*x*y - sin(x) / y + sqrt(abs(y)) * pi"
+
+func TestProgramMatchesEvaluate(t *testing.T) {
+	exprs := []string{
+		benchExpr,
+		"-x^2 + -(y - 1)",
+		"max(x, y, 2) - min(x, -y)",
+		"log(2, abs(x) + 1) + ln(e) + exp(0)",
+		"2^3^2 / x",
+		"42",
+		"x > 0 ? x : -x",
+		"x < y && y != 0 || !(x >= 1) ? 1 / y : x <= 2 == 1",
+		"y > 0 && sqrt(y) > 1 ? max(x, y == 2 ? 5 : 6) : 0",
+		"x % y + x // y * y - x mod 0.3",
+		"100 * x + 15% - y%",
+		"median(x, y, 3, x * y) + median([y, x]) * x",
+	}
+	points := [][2]float64{{1, 2}, {-0.5, 3.25}, {7, -1e-3}}
+
+	for _, expr := range exprs {
+		p, err := Compile(expr)
+		if err != nil {
+			t.Fatalf("Compile(%q) unexpected error: %v", expr, err)
+		}
+		for _, point := range points {
+			env := NewEnv()
+			env.Set("x", point[0])
+			env.Set("y", point[1])
+			want, err := evaluate(expr, env)
+			if err != nil {
+				t.Fatalf("evaluate(%q) unexpected error: %v", expr, err)
+			}
+
+			vars := make([]float64, 0, 2)
+			for _, name := range p.Vars() {
+				value, _ := env.Get(name)
+				vars = append(vars, value)
+			}
+			got, err := p.Eval(vars)
+			if err != nil || got != want {
+				t.Errorf("Compile(%q).Eval(%v) = %v, %v, expected %v", expr, vars, got, err, want)
+			}
+		}
+	}
+}
+
+func TestProgramVars(t *testing.T) {
+	p, err := Compile("b * a + b - pi")
+	if err != nil {
+		t.Fatalf("Compile unexpected error: %v", err)
+	}
+	if vars := p.Vars(); !reflect.DeepEqual(vars, []string{"b", "a"}) {
+		t.Errorf("Vars() = %v, expected [b a]", vars)
+	}
+	if _, err := p.Eval([]float64{1}); err == nil {
+		t.Errorf("Eval with one value for two variables: expected error")
+	}
+}
+
+func TestProgramErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		vars []float64
+		code ErrorCode
+		pos  int
+	}{
+		{"1 + 2 / (x - 1)", []float64{1}, ErrDivisionByZero, 6},
+		{"log(x, 8)", []float64{1}, ErrDomain, 0},
+		{"x > 0 ? 1 / x : 1 / (x + 1)", []float64{-1}, ErrDivisionByZero, 18},
+		{"2 + 7 % x", []float64{0}, ErrDivisionByZero, 6},
+		{"7 // (x - 1)", []float64{1}, ErrDivisionByZero, 2},
+	}
+
+	for _, tt := range tests {
+		p, err := Compile(tt.expr)
+		if err != nil {
+			t.Fatalf("Compile(%q) unexpected error: %v", tt.expr, err)
+		}
+		_, err = p.Eval(tt.vars)
+		var calcErr *CalcError
+		if !errors.As(err, &calcErr) || calcErr.Code != tt.code || calcErr.Pos != tt.pos {
+			t.Errorf("Compile(%q).Eval(%v) error = %v, expected code %d at %d", tt.expr, tt.vars, err, tt.code, tt.pos)
+		}
+	}
+
+	for _, expr := range []string{"1 +", "foo(1)", "2i", "1e400"} {
+		if _, err := Compile(expr); err == nil {
+			t.Errorf("Compile(%q): expected error", expr)
+		}
+	}
+}
+
+func TestProgramEvalDoesNotAllocate(t *testing.T) {
+	for _, expr := range []string{benchExpr, "median(x, y, 3, sum([x, y]), x * y)"} {
+		p, err := Compile(expr)
+		if err != nil {
+			t.Fatalf("Compile(%q) unexpected error: %v", expr, err)
+		}
+		vars := []float64{1.5, 2.5}
+		allocs := testing.AllocsPerRun(100, func() {
+			vars[0] += 0.001
+			if _, err := p.Eval(vars); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("Compile(%q).Eval allocates %v times per run, expected 0", expr, allocs)
+		}
+		if v, _ := p.Eval([]float64{1, 1}); math.IsNaN(v) {
+			t.Errorf("Compile(%q).Eval = NaN", expr)
+		}
+	}
+}
+
+// Полный конвейер: разбор строки при каждом вычислении
+func BenchmarkEvaluate(b *testing.B) {
+	env := NewEnv()
+	for i := 0; i < b.N; i++ {
+		env.Set("x", float64(i))
+		env.Set("y", 2.5)
+		if _, err := evaluate(benchExpr, env); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Постфиксная запись разобрана заранее, переменные ищутся в Env
+func BenchmarkEvaluatePostfix(b *testing.B) {
+	postfix, err := toPostfix(benchExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	env := NewEnv()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		env.Set("x", float64(i))
+		env.Set("y", 2.5)
+		if _, err := evaluatePostfix(postfix, env); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProgramEval(b *testing.B) {
+	p, err := Compile(benchExpr)
+	if err != nil {
+		b.Fatal(err)
+	}
+	vars := []float64{0, 2.5}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vars[0] = float64(i)
+		if _, err := p.Eval(vars); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Команда mycalc — калькулятор в терминале или HTTP-сервер поверх пакета mycalc/calc.
+//
+//	mycalc                                 интерактивный режим (REPL), :help — список команд
+//	mycalc -serve :8080                    HTTP-сервер с /eval, /tokens и /postfix
+//	mycalc -batch formulas.txt -format csv вычислить файл по выражению на строке; "-" — стандартный ввод
+//
+// В пакетном режиме -mode задаёт числовую систему, -parallel — число одновременно вычисляемых строк.
+// Код выхода 1 означает, что хотя бы одна строка не вычислилась, 2 — ошибку чтения, записи или флагов.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"mycalc/calc"
+)
+
+func main() {
+	addr := flag.String("serve", "", "запустить HTTP-сервер на адресе, например :8080, вместо REPL")
+	batch := flag.String("batch", "", "вычислить выражения из файла, по одному на строке; - — стандартный ввод")
+	format := flag.String("format", "csv", "формат вывода пакетного режима: csv или jsonl")
+	mode := flag.String("mode", "float", "режим пакетного режима: float, rat, big, complex или units")
+	parallel := flag.Int("parallel", 1, "сколько строк пакетного режима вычислять одновременно")
+	flag.Parse()
+
+	if *batch != "" {
+		os.Exit(runBatch(*batch, *format, *mode, *parallel))
+	}
+
+	if *addr != "" {
+		fmt.Fprintln(os.Stderr, "Сервер калькулятора слушает", *addr)
+		server := &http.Server{
+			Addr:              *addr,
+			Handler:           calc.NewServer(),
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      calc.EvalTimeout + 5*time.Second, // ответ о тайм-ауте вычисления должен успеть уйти
+			IdleTimeout:       time.Minute,
+		}
+		if err := server.ListenAndServe(); err != nil {
+			fmt.Fprintln(os.Stderr, "Ошибка сервера:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := calc.RunREPL(os.Stdin, os.Stdout, calc.NewEnv()); err != nil {
+		fmt.Fprintln(os.Stderr, "Ошибка чтения:", err)
+		os.Exit(1)
+	}
+}
+
+// runBatch выполняет пакетный режим и возвращает код выхода.
+func runBatch(path, formatName, modeName string, parallel int) int {
+
+	cfg := calc.BatchConfig{Parallel: parallel}
+	var err error
+	if cfg.Format, err = calc.ParseBatchFormat(formatName); err != nil {
+		fmt.Fprintln(os.Stderr, "Ошибка:", err)
+		return 2
+	}
+	if cfg.Options.Mode, err = calc.ParseMode(modeName); err != nil {
+		fmt.Fprintln(os.Stderr, "Ошибка:", err)
+		return 2
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Ошибка:", err)
+			return 2
+		}
+		defer file.Close()
+		in = file
+	}
+
+	failed, err := calc.RunBatch(in, os.Stdout, cfg)
+	switch {
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "Ошибка:", err)
+		return 2
+	case failed > 0:
+		fmt.Fprintf(os.Stderr, "Строк с ошибками: %d\n", failed)
+		return 1
+	}
+	return 0
+}